@@ -6,8 +6,10 @@ import (
 
 var (
 	BadCredentialsError error = errors.New("Bad credentials")
-	defaultScope        Scope
-	defaultS2S          *serviceToService // TODO delete when removing s2s rules
+	// ExpiredUserError is returned by Cacher.Store when the user has already expired, and so was not cached
+	ExpiredUserError error = errors.New("User has already expired")
+	defaultScope     Scope
+	defaultS2S       *serviceToService // TODO delete when removing s2s rules
 )
 
 func init() {
@@ -21,6 +23,13 @@ func Invalidate(sessId string) error {
 	return c.Invalidate(sessId)
 }
 
+// InvalidateByUser wraps `InvalidateByUser` against our default memcache-based `Cacher`, invalidating all of a user's
+// cached sessions (see hailo/service/authentication/userIndex)
+func InvalidateByUser(userId string) error {
+	c := &memcacheCacher{}
+	return c.InvalidateByUser(userId)
+}
+
 // SetCurrentService defines the current service, as used for service-to-service auth
 // This defines who _we_ are, and thus which rules we'll load that define which other
 // services will be allowed via HasAccess to call us with assumed role auth
@@ -2,10 +2,15 @@ package auth
 
 import (
 	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"time"
 
 	log "github.com/cihub/seelog"
 
+	"github.com/hailocab/service-layer/config"
 	inst "github.com/hailocab/service-layer/instrumentation"
 	mc "github.com/hailocab/service-layer/memcache"
 	"github.com/hailocab/gomemcache/memcache"
@@ -14,10 +19,13 @@ import (
 const (
 	invalidPlaceholder = "invalid"
 	invalidateTimeout  = 3600
+	// Prefix added to all of our cache keys, so they can't collide with other users of a shared memcache cluster
+	defaultCacheKeyPrefix = "auth:"
 )
 
 type Cacher interface {
 	Store(u *User) error
+	StoreMulti(users []*User) error
 	Invalidate(sessId string) error
 	Fetch(sessId string) (u *User, cacheHit bool, err error)
 	Purge(sessId string) error
@@ -25,25 +33,199 @@ type Cacher interface {
 
 type memcacheCacher struct{}
 
+// cacheKey returns the memcache key under which we store details about sessId
+func cacheKey(sessId string) string {
+	return config.AtPath("hailo", "service", "authentication", "cacheKeyPrefix").AsString(defaultCacheKeyPrefix) +
+		sessId
+}
+
+// cacheBypassPrefixes returns the prefixes of sessIds which are never cached (eg. high-security session types which
+// must always be validated by the login service)
+func cacheBypassPrefixes() []string {
+	return config.AtPath("hailo", "service", "authentication", "cacheBypassPrefixes").AsStringArray(nil)
+}
+
+// bypassesCache returns whether sessId matches any of prefixes, and so should never be cached
+func bypassesCache(sessId string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(sessId, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // Store will add a user to our token cache; non-nil error indicates we failed
-// to add them to the token cache
+// to add them to the token cache. Sessions matching cacheBypassPrefixes are
+// silently not cached (and Fetch always misses for them). A user who has already expired is not
+// cached, and ExpiredUserError is returned.
 func (c *memcacheCacher) Store(u *User) error {
 	t := time.Now()
 	err := c.doStore(u)
+	if err == ExpiredUserError {
+		inst.Counter(1.0, "auth.cache.store.expired", 1)
+		instTiming("auth.cache.store", nil, t)
+		return err
+	}
 	instTiming("auth.cache.store", err, t)
 	return err
 }
 
 func (c *memcacheCacher) doStore(u *User) error {
+	if bypassesCache(u.SessId, cacheBypassPrefixes()) {
+		log.Tracef("[Auth] Not caching session %s, which bypasses the cache", u.SessId)
+		inst.Counter(1.0, "auth.cache.store.bypassed", 1)
+		return nil
+	}
+
+	item, err := storeItem(u)
+	if err != nil {
+		return err
+	}
+	if err := mc.Set(item); err != nil {
+		return err
+	}
+	if err := indexSession(u); err != nil {
+		// The session is cached regardless; it just won't be found by InvalidateByUser
+		log.Warnf("[Auth] Failed to index session %s of user %s: %v", u.SessId, u.Id, err)
+	}
+	return nil
+}
+
+// cacheTtlJitter returns the window over which the expiry of cached sessions is spread (zero disables jitter)
+func cacheTtlJitter() time.Duration {
+	return config.AtPath("hailo", "service", "authentication", "cacheTtlJitter").AsDuration("0")
+}
+
+// jitteredTtl returns ttl (in seconds) reduced by a random amount of up to window, so that sessions which expire at
+// the same time (eg. those created by a batch login) don't all drop out of the cache at once and stampede the login
+// service. A session is never cached beyond its expiry, so the TTL is only ever shortened (and remains positive).
+func jitteredTtl(ttl int32, window time.Duration) int32 {
+	w := int64(window / time.Second)
+	if w <= 0 || ttl <= 1 {
+		return ttl
+	}
+	if w >= int64(ttl) {
+		w = int64(ttl) - 1
+	}
+	return ttl - int32(rand.Int63n(w+1))
+}
+
+// storeItem returns the item under which u is cached, or ExpiredUserError if u shouldn't be cached (or an error if
+// u can't be marshalled)
+func storeItem(u *User) (*memcache.Item, error) {
 	ttl := int32(0)
 	if !u.ExpiryTs.IsZero() {
 		ttl = int32(u.ExpiryTs.Sub(time.Now()).Seconds())
+		// A non-positive TTL would not mean "expire now" to memcache (zero means never expire), so don't store at all
+		if ttl <= 0 {
+			log.Debugf("[Auth] Not caching session %s, which expired at %v", u.SessId, u.ExpiryTs)
+			return nil, ExpiredUserError
+		}
+		ttl = jitteredTtl(ttl, cacheTtlJitter())
 	}
-	return mc.Set(&memcache.Item{
-		Key:        u.SessId,
-		Value:      u.Token,
-		Expiration: ttl,
-	})
+	value, err := MarshalUser(u)
+	if err != nil {
+		return nil, err
+	}
+	return &memcache.Item{
+		Key:        cacheKey(u.SessId),
+		Value:      value,
+		Expiration: mc.Expiration(time.Duration(ttl) * time.Second),
+	}, nil
+}
+
+// StoreMulti will add many users to our token cache, in a single round-trip
+// where the memcache client supports it. Users who have already expired are
+// not cached (and this is not an error). If any users could not be cached, the
+// error is a *StoreMultiError naming their sessions.
+func (c *memcacheCacher) StoreMulti(users []*User) error {
+	_, err := c.storeMultiCounted(users)
+	return err
+}
+
+// storeMultiCounted behaves as StoreMulti, also returning how many users were actually cached (those which were
+// skipped, having expired or bypassing the cache, aren't counted)
+func (c *memcacheCacher) storeMultiCounted(users []*User) (int, error) {
+	t := time.Now()
+	n, err := c.doStoreMulti(users)
+	instTiming("auth.cache.storeMulti", err, t)
+	return n, err
+}
+
+func (c *memcacheCacher) doStoreMulti(users []*User) (int, error) {
+	items := make([]*memcache.Item, 0, len(users))
+	stored := make([]*User, 0, len(users))
+	sessIds := make(map[string]string, len(users)) // cache key -> sessId
+	failed := make(map[string]error)               // sessId -> error
+	bypassPrefixes := cacheBypassPrefixes()
+	for _, u := range users {
+		if bypassesCache(u.SessId, bypassPrefixes) {
+			inst.Counter(1.0, "auth.cache.store.bypassed", 1)
+			continue
+		}
+		item, err := storeItem(u)
+		if err == ExpiredUserError {
+			inst.Counter(1.0, "auth.cache.store.expired", 1)
+			continue
+		} else if err != nil {
+			failed[u.SessId] = err
+			continue
+		}
+		items = append(items, item)
+		stored = append(stored, u)
+		sessIds[item.Key] = u.SessId
+	}
+	if len(items) == 0 {
+		return 0, storeMultiErr(failed)
+	}
+
+	switch err := mc.SetMulti(items).(type) {
+	case nil:
+	case *mc.SetMultiError:
+		for key, keyErr := range err.Failed {
+			failed[sessIds[key]] = keyErr
+		}
+	default:
+		// Nothing was stored
+		for _, sessId := range sessIds {
+			failed[sessId] = err
+		}
+	}
+
+	n := 0
+	for _, u := range stored {
+		if _, ok := failed[u.SessId]; ok {
+			continue
+		}
+		n++
+		if err := indexSession(u); err != nil {
+			log.Warnf("[Auth] Failed to index session %s of user %s: %v", u.SessId, u.Id, err)
+		}
+	}
+	return n, storeMultiErr(failed)
+}
+
+// storeMultiErr returns a *StoreMultiError for the failed sessions, or nil if there were none
+func storeMultiErr(failed map[string]error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return &StoreMultiError{Failed: failed}
+}
+
+// StoreMultiError is returned by StoreMulti when some users could not be cached
+type StoreMultiError struct {
+	Failed map[string]error // Keyed by sessId
+}
+
+func (e *StoreMultiError) Error() string {
+	sessIds := make([]string, 0, len(e.Failed))
+	for sessId := range e.Failed {
+		sessIds = append(sessIds, sessId)
+	}
+	sort.Strings(sessIds)
+	return fmt.Sprintf("Failed to cache %d sessions: %s", len(sessIds), strings.Join(sessIds, ", "))
 }
 
 // Invalidate will keep track of the fact this sessId is not valid, to save
@@ -58,7 +240,7 @@ func (c *memcacheCacher) Invalidate(sessId string) error {
 
 func (c *memcacheCacher) doInvalidate(sessId string) error {
 	return mc.Set(&memcache.Item{
-		Key:        sessId,
+		Key:        cacheKey(sessId),
 		Value:      []byte(invalidPlaceholder),
 		Expiration: invalidateTimeout,
 	})
@@ -80,7 +262,13 @@ func (c *memcacheCacher) Fetch(sessId string) (u *User, cacheHit bool, err error
 }
 
 func (c *memcacheCacher) doFetch(sessId string) (u *User, cacheHit bool, err error) {
-	it, err := mc.Get(sessId)
+	if bypassesCache(sessId, cacheBypassPrefixes()) {
+		log.Tracef("[Auth] Token cache - bypassed for %s", sessId)
+		inst.Counter(1.0, "auth.cache.fetch.bypassed", 1)
+		return nil, false, nil
+	}
+
+	it, err := mc.Get(cacheKey(sessId))
 	if err != nil && err != memcache.ErrCacheMiss {
 		// actual error
 		log.Warnf("[Auth] Token cache fetch error for '%s': %v", sessId, err)
@@ -99,16 +287,87 @@ func (c *memcacheCacher) doFetch(sessId string) (u *User, cacheHit bool, err err
 		return nil, true, nil
 	}
 
-	u, err = FromSessionToken(sessId, string(it.Value))
+	u, err = UnmarshalUser(sessId, it.Value)
 	if err != nil {
 		// found, but we can't decode - treat as not found
-		log.Warnf("[Auth] Token cache decode error: %v", err)
+		c.decodeFailed(sessId, err)
 		return nil, false, nil
 	}
 
 	return u, true, nil
 }
 
+// FetchMulti retrieves many sessions from the token cache in a single round-trip, returning those which were found.
+// A session cached as invalid maps to a nil user; one which can't be decoded is treated as not found.
+func (c *memcacheCacher) FetchMulti(sessIds []string) (map[string]*User, error) {
+	t := time.Now()
+	users, err := c.doFetchMulti(sessIds)
+	instTiming("auth.cache.fetchMulti", err, t)
+	return users, err
+}
+
+func (c *memcacheCacher) doFetchMulti(sessIds []string) (map[string]*User, error) {
+	bypassPrefixes := cacheBypassPrefixes()
+	cacheable := make([]string, 0, len(sessIds))
+	for _, sessId := range sessIds {
+		if !bypassesCache(sessId, bypassPrefixes) {
+			cacheable = append(cacheable, sessId)
+		}
+	}
+	sessIds = cacheable
+
+	keys := make([]string, len(sessIds))
+	for i, sessId := range sessIds {
+		keys[i] = cacheKey(sessId)
+	}
+
+	items, err := mc.GetMulti(keys)
+	if err != nil {
+		log.Warnf("[Auth] Token cache multi-fetch error for %d sessions: %v", len(sessIds), err)
+		return nil, err
+	}
+
+	users := make(map[string]*User, len(items))
+	for i, sessId := range sessIds {
+		it, ok := items[keys[i]]
+		if !ok {
+			continue
+		}
+		if bytes.Equal(it.Value, []byte(invalidPlaceholder)) {
+			users[sessId] = nil
+			continue
+		}
+		u, err := UnmarshalUser(sessId, it.Value)
+		if err != nil {
+			c.decodeFailed(sessId, err)
+			continue
+		}
+		users[sessId] = u
+	}
+	return users, nil
+}
+
+// purgeUndecodable returns whether cached values which can't be decoded are purged, rather than just being ignored
+func purgeUndecodable() bool {
+	return config.AtPath("hailo", "service", "authentication", "purgeUndecodable").AsBool(false)
+}
+
+// decodeFailed handles a cached value for sessId which couldn't be decoded (which is then treated as a miss). Failures
+// are counted, so that a token format change which has effectively invalidated the whole cache can be spotted, and if
+// purgeUndecodable is set the value is removed so it isn't fetched (and fails to decode) again.
+func (c *memcacheCacher) decodeFailed(sessId string, err error) {
+	log.Warnf("[Auth] Token cache decode error for %s: %v", sessId, err)
+	inst.Counter(1.0, "auth.cache.fetch.decodeFailure", 1)
+	if !purgeUndecodable() {
+		return
+	}
+	if err := c.Purge(sessId); err != nil {
+		log.Warnf("[Auth] Failed to purge undecodable token for %s: %v", sessId, err)
+		return
+	}
+	inst.Counter(1.0, "auth.cache.fetch.decodeFailure.purged", 1)
+}
+
 // Purge will remove knowledge about a sessId from the token cache. If the
 // sessId doesn't exist then this will be classed as success. Non-nil error
 // indicates we failed to remove this cache key.
@@ -121,9 +380,11 @@ func (c *memcacheCacher) Purge(sessId string) error {
 }
 
 func (c *memcacheCacher) doPurge(sessId string) error {
-	if err := mc.Delete(sessId); err != nil {
+	existed, err := mc.DeleteResult(cacheKey(sessId))
+	if err != nil {
 		return err
 	}
 
+	log.Tracef("[Auth] Token cache - purged %s (existed: %v)", sessId, existed)
 	return nil
 }
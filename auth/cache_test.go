@@ -1,7 +1,18 @@
 package auth
 
 import (
+	"bytes"
 	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hailocab/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+	inst "github.com/hailocab/service-layer/instrumentation"
+	mc "github.com/hailocab/service-layer/memcache"
 )
 
 // testCache is for testing
@@ -26,6 +37,19 @@ func (c *testCache) Store(u *User) error {
 	return nil
 }
 
+func (c *testCache) StoreMulti(users []*User) error {
+	failed := map[string]error{}
+	for _, u := range users {
+		if err := c.Store(u); err != nil {
+			failed[u.SessId] = err
+		}
+	}
+	if len(failed) > 0 {
+		return &StoreMultiError{Failed: failed}
+	}
+	return nil
+}
+
 func (c *testCache) Invalidate(sessId string) error {
 	if c.failure {
 		return errors.New("Simulated failure")
@@ -62,3 +86,186 @@ func (c *testCache) Purge(sessId string) error {
 	}
 	return nil
 }
+
+// fakeMemcache is an in-memory memcache client, for testing memcacheCacher
+type fakeMemcache struct {
+	sync.Mutex
+	items map[string]*memcache.Item
+}
+
+func newFakeMemcache() *fakeMemcache {
+	return &fakeMemcache{
+		items: make(map[string]*memcache.Item),
+	}
+}
+
+func (c *fakeMemcache) Add(item *memcache.Item) error {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.items[item.Key]; ok {
+		return memcache.ErrNotStored
+	}
+	c.items[item.Key] = item
+	return nil
+}
+
+func (c *fakeMemcache) CompareAndSwap(item *memcache.Item) error {
+	return c.Set(item)
+}
+
+func (c *fakeMemcache) Decrement(key string, delta uint64) (uint64, error) {
+	return 0, memcache.ErrCacheMiss
+}
+
+func (c *fakeMemcache) Delete(key string) error {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.items[key]; !ok {
+		return memcache.ErrCacheMiss
+	}
+	delete(c.items, key)
+	return nil
+}
+
+func (c *fakeMemcache) Get(key string) (*memcache.Item, error) {
+	c.Lock()
+	defer c.Unlock()
+	if it, ok := c.items[key]; ok {
+		return it, nil
+	}
+	return nil, memcache.ErrCacheMiss
+}
+
+func (c *fakeMemcache) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	c.Lock()
+	defer c.Unlock()
+	ret := make(map[string]*memcache.Item)
+	for _, key := range keys {
+		if it, ok := c.items[key]; ok {
+			ret[key] = it
+		}
+	}
+	return ret, nil
+}
+
+func (c *fakeMemcache) Increment(key string, delta uint64) (uint64, error) {
+	return 0, memcache.ErrCacheMiss
+}
+
+func (c *fakeMemcache) Set(item *memcache.Item) error {
+	c.Lock()
+	defer c.Unlock()
+	c.items[item.Key] = item
+	return nil
+}
+
+func TestFetchUndecodable(t *testing.T) {
+	defer mc.SetClient(mc.SetClient(newFakeMemcache()))
+	config.Load(bytes.NewBufferString(`{}`))
+	inst.SaveCounter("auth.cache.fetch.decodeFailure")
+	failures := inst.GetCounter("auth.cache.fetch.decodeFailure").Count()
+
+	c := &memcacheCacher{}
+	assert.NoError(t, mc.Set(&memcache.Item{Key: cacheKey("undecodable"), Value: []byte("garbage")}))
+	u, hit, err := c.Fetch("undecodable")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+	assert.False(t, hit, "A value which can't be decoded should be treated as a miss")
+	assert.Equal(t, failures+1, inst.GetCounter("auth.cache.fetch.decodeFailure").Count())
+	_, err = mc.Get(cacheKey("undecodable"))
+	assert.NoError(t, err, "The value should be kept unless purgeUndecodable is set")
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"authentication": {"purgeUndecodable": true}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	users, err := c.FetchMulti([]string{"undecodable"})
+	assert.NoError(t, err)
+	assert.Len(t, users, 0)
+	assert.Equal(t, failures+2, inst.GetCounter("auth.cache.fetch.decodeFailure").Count())
+	_, err = mc.Get(cacheKey("undecodable"))
+	assert.Equal(t, memcache.ErrCacheMiss, err, "The value should have been purged")
+}
+
+func TestCacheKeyPrefix(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{}`))
+	assert.Equal(t, "auth:sess123", cacheKey("sess123"))
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"authentication": {"cacheKeyPrefix": "myauth/"}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	assert.Equal(t, "myauth/sess123", cacheKey("sess123"))
+}
+
+func TestStoreExpiredUser(t *testing.T) {
+	c := &memcacheCacher{}
+	u := &User{
+		SessId:   "sess123",
+		ExpiryTs: time.Now().Add(-time.Minute),
+	}
+	assert.Equal(t, ExpiredUserError, c.Store(u))
+}
+
+func TestStoreItemLongLivedSession(t *testing.T) {
+	expiry := time.Now().Add(60 * 24 * time.Hour)
+	item, err := storeItem(&User{SessId: "sess123", ExpiryTs: expiry, Token: []byte("token")})
+	assert.NoError(t, err)
+	// memcache reads expirations over 30 days as unix timestamps, so the TTL in seconds would have expired immediately
+	assert.True(t, int64(item.Expiration) > time.Now().Unix(), "Expiration %d should be a timestamp", item.Expiration)
+	assert.True(t, int64(item.Expiration) <= expiry.Unix())
+}
+
+func TestStoreMultiExpiredUsers(t *testing.T) {
+	c := &memcacheCacher{}
+	users := []*User{
+		{SessId: "sess1", ExpiryTs: time.Now().Add(-time.Minute)},
+		{SessId: "sess2", ExpiryTs: time.Now().Add(-time.Hour)},
+	}
+	assert.NoError(t, c.StoreMulti(users), "Expired users should be skipped, not fail")
+
+	n, err := storeMulti(c, users)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n, "Skipped users shouldn't be counted as cached")
+}
+
+func TestStoreMultiError(t *testing.T) {
+	err := &StoreMultiError{Failed: map[string]error{
+		"sess2": errors.New("Timeout"),
+		"sess1": errors.New("Timeout"),
+	}}
+	assert.EqualError(t, err, "Failed to cache 2 sessions: sess1, sess2")
+}
+
+func TestCacheBypassPrefixes(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"authentication": {
+		"cacheBypassPrefixes": ["admin-", "secure-"]
+	}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	prefixes := cacheBypassPrefixes()
+	assert.True(t, bypassesCache("admin-sess123", prefixes))
+	assert.True(t, bypassesCache("secure-sess123", prefixes))
+	assert.False(t, bypassesCache("sess123", prefixes))
+
+	// Neither storing nor fetching a bypassed session touches memcache
+	c := &memcacheCacher{}
+	assert.NoError(t, c.Store(&User{SessId: "admin-sess123", ExpiryTs: time.Now().Add(time.Hour)}))
+	u, hit, err := c.Fetch("admin-sess123")
+	assert.Nil(t, u)
+	assert.False(t, hit)
+	assert.NoError(t, err)
+}
+
+func TestJitteredTtl(t *testing.T) {
+	assert.Equal(t, int32(3600), jitteredTtl(3600, 0), "Jitter should be off by default")
+
+	spread := map[int32]bool{}
+	for i := 0; i < 1000; i++ {
+		ttl := jitteredTtl(3600, time.Minute)
+		assert.True(t, ttl > 3600-60-1 && ttl <= 3600, "TTL %d outside of jitter window", ttl)
+		spread[ttl] = true
+	}
+	assert.True(t, len(spread) > 1, "TTLs should be spread across the window")
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, jitteredTtl(5, time.Hour) >= 1, "Jittered TTL should remain positive")
+	}
+	assert.Equal(t, int32(1), jitteredTtl(1, time.Hour))
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"encoding/base64"
+	"fmt"
 	"github.com/hailocab/platform-layer/validate"
 	"strconv"
 	"strings"
@@ -82,3 +83,23 @@ func FromSessionToken(s, t string) (*User, error) {
 
 	return u, nil
 }
+
+// MarshalUser returns the serialised form of a user, as stored by the token
+// cache. This is the (signed) session token the user was loaded from, so it
+// round-trips through UnmarshalUser.
+func MarshalUser(u *User) ([]byte, error) {
+	if u == nil {
+		return nil, fmt.Errorf("Cannot marshal nil user")
+	}
+	if len(u.Token) == 0 {
+		return nil, fmt.Errorf("Cannot marshal user %s without a token", u.SessId)
+	}
+	return u.Token, nil
+}
+
+// UnmarshalUser turns data produced by MarshalUser back into a user for the
+// given session; the token is validated and its signature checked, exactly
+// as FromSessionToken does.
+func UnmarshalUser(sessId string, data []byte) (*User, error) {
+	return FromSessionToken(sessId, string(data))
+}
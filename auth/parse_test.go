@@ -33,3 +33,35 @@ func TestTokenRoleOrderPreservation(t *testing.T) {
 		"ADMIN.DRIVER.LON.ABC",
 	}, u.Roles)
 }
+
+func TestMarshalUserRoundTrip(t *testing.T) {
+	mockValidator()
+	defer unmockValidator()
+
+	token := "am=admin:d=cli:id=dave:ct=1372956175:et=1372984975:rt=:r=ADMIN,CUSTOMER:sig=MTIz"
+	u, err := FromSessionToken("testSessionId", token)
+	assert.NoError(t, err)
+
+	data, err := MarshalUser(u)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(token), data)
+
+	u2, err := UnmarshalUser("testSessionId", data)
+	assert.NoError(t, err)
+	assert.Equal(t, u, u2)
+}
+
+func TestMarshalUserWithoutToken(t *testing.T) {
+	_, err := MarshalUser(nil)
+	assert.Error(t, err)
+	_, err = MarshalUser(&User{SessId: "testSessionId"})
+	assert.EqualError(t, err, "Cannot marshal user testSessionId without a token")
+}
+
+func TestUnmarshalUserInvalid(t *testing.T) {
+	mockValidator()
+	defer unmockValidator()
+
+	_, err := UnmarshalUser("testSessionId", []byte("garbage"))
+	assert.Error(t, err)
+}
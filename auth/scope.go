@@ -11,6 +11,7 @@ import (
 	"github.com/hailocab/platform-layer/errors"
 	"github.com/hailocab/platform-layer/multiclient"
 	inst "github.com/hailocab/service-layer/instrumentation"
+	"github.com/hailocab/service-layer/singleflight"
 
 	loginproto "github.com/hailocab/go-login-service/proto"
 	authproto "github.com/hailocab/go-login-service/proto/auth"
@@ -56,6 +57,10 @@ type realScope struct {
 	triedAuth bool // we set to true if/when we attempt to recover session scope
 
 	authorised bool // whether the request has been authorised
+
+	// sessionLookups coalesces concurrent login service lookups of the same session through this scope. Lookups are
+	// only shared within a scope, as they are made with its rpcScoper and cached in its userCache.
+	sessionLookups singleflight.Group
 }
 
 // New mints a new scope
@@ -129,55 +134,78 @@ func (s *realScope) RecoverSession(sessId string) error {
 func (s *realScope) doRecoverSession(sessId string) (*User, error) {
 	// Check cache; ignore errors (will have impact on service performance, but not functionality)
 	queryLogin := false
+	fallthroughReason := "miss"
 	u, hit, err := s.userCache.Fetch(sessId)
 	if err != nil {
 		log.Warnf("[Auth] Error fetching session from cache (will call login service): %v", err)
 		queryLogin = true
+		fallthroughReason = "error"
 	} else if u != nil && u.ExpiryTs.Before(time.Now()) && u.CanAutoRenew() { // Cached token has expired
 		log.Infof("[Auth] Cache-recovered token has expired (%s); will call login service", u.ExpiryTs.String())
 		queryLogin = true
+		fallthroughReason = "expired"
 	} else {
 		queryLogin = u == nil && !hit
 	}
 
 	if queryLogin {
-		cl := multiclient.New().DefaultScopeFrom(s.getRpcScope())
-		rsp := &sessreadproto.Response{}
-		cl.AddScopedReq(&multiclient.ScopedReq{
-			Uid:      "readsess",
-			Service:  loginService,
-			Endpoint: readSessionEndpoint,
-			Req: &sessreadproto.Request{
-				SessId: proto.String(sessId),
-			},
-			Rsp: rsp,
+		// Count calls to the login service the cache failed to save us from, by reason
+		inst.Counter(1.0, "auth.cache.fallthrough."+fallthroughReason, 1)
+		// Concurrent misses for the same session share a single call to the login service; each gets its own copy of
+		// the user, so that they are free to modify it
+		v, shared, err := s.sessionLookups.Do(sessId, func() (interface{}, error) {
+			return s.readSession(sessId)
 		})
-
-		if cl.Execute().AnyErrorsIgnoring([]string{errors.ErrorNotFound}, nil) {
-			err := cl.Succeeded("readsess")
-			log.Errorf("[Auth] Auth scope recovery error [%s: %s] %v", err.Type(), err.Code(), err.Description())
-			return nil, err
+		if shared {
+			inst.Counter(1.0, "auth.readSession.coalesced", 1)
 		}
+		u, _ := v.(*User)
+		return u.copy(), err
+	}
 
-		// found a session?
-		if rsp.GetSessId() == "" && rsp.GetToken() == "" {
-			log.Debugf("[Auth] Session '%s' not found (not valid) when trying to recover from login service", sessId)
-			// @todo we could cache this (at least for a short time) to prevent repeated hammering of login service
-		} else {
-			u, err = FromSessionToken(rsp.GetSessId(), rsp.GetToken())
-			if err != nil {
-				log.Errorf("[Auth] Error getting user from session: %v", err)
-			} else {
-				log.Tracef("[Auth] Auth scope - recovered user '%s' from session '%s'", u.Id, rsp.GetSessId())
-			}
-		}
+	return u, nil
+}
 
-		// ignore errors; just means we have no user
-		if u != nil {
-			s.userCache.Store(u)
+// readSession looks up sessId with the login service, caching the user if one is found. A session which isn't found
+// (or can't be decoded) is not an error: the user is just nil.
+func (s *realScope) readSession(sessId string) (*User, error) {
+	cl := multiclient.New().DefaultScopeFrom(s.getRpcScope())
+	rsp := &sessreadproto.Response{}
+	cl.AddScopedReq(&multiclient.ScopedReq{
+		Uid:      "readsess",
+		Service:  loginService,
+		Endpoint: readSessionEndpoint,
+		Req: &sessreadproto.Request{
+			SessId: proto.String(sessId),
+		},
+		Rsp: rsp,
+	})
+
+	if cl.Execute().AnyErrorsIgnoring([]string{errors.ErrorNotFound}, nil) {
+		err := cl.Succeeded("readsess")
+		log.Errorf("[Auth] Auth scope recovery error [%s: %s] %v", err.Type(), err.Code(), err.Description())
+		return nil, err
+	}
+
+	// found a session?
+	var u *User
+	if rsp.GetSessId() == "" && rsp.GetToken() == "" {
+		log.Debugf("[Auth] Session '%s' not found (not valid) when trying to recover from login service", sessId)
+		// @todo we could cache this (at least for a short time) to prevent repeated hammering of login service
+	} else {
+		var err error
+		u, err = FromSessionToken(rsp.GetSessId(), rsp.GetToken())
+		if err != nil {
+			log.Errorf("[Auth] Error getting user from session: %v", err)
+		} else {
+			log.Tracef("[Auth] Auth scope - recovered user '%s' from session '%s'", u.Id, rsp.GetSessId())
 		}
 	}
 
+	// ignore errors; just means we have no user
+	if u != nil {
+		s.userCache.Store(u)
+	}
 	return u, nil
 }
 
@@ -272,7 +300,7 @@ func (s *realScope) doAuth(mech, device string, creds map[string]string) (*User,
 		return nil, err
 	}
 
-	if err := s.userCache.Store(u); err != nil {
+	if err := s.userCache.Store(u); err != nil && err != ExpiredUserError {
 		log.Errorf("[Auth] Error caching session: %v", err)
 	}
 
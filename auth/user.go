@@ -38,6 +38,19 @@ var RoleGlobOptions = &glob.Options{
 	MatchAtEnd:   true,
 }
 
+// copy returns a deep copy of the user (nil if u is nil)
+func (u *User) copy() *User {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	c.Roles = append([]string(nil), u.Roles...)
+	c.Token = append([]byte(nil), u.Token...)
+	c.Sig = append([]byte(nil), u.Sig...)
+	c.Data = append([]byte(nil), u.Data...)
+	return &c
+}
+
 // CanAutoRenew tests if the token can be auto-renewed at this time (by the
 // login service)
 func (u *User) CanAutoRenew() bool {
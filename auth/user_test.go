@@ -100,3 +100,23 @@ func TestCanAutoRenew(t *testing.T) {
 		t.Errorf("Expected user to auto renew")
 	}
 }
+
+func TestUserCopy(t *testing.T) {
+	u := &User{
+		SessId: "sess",
+		Id:     "dave",
+		Roles:  []string{"ADMIN"},
+		Token:  []byte("token"),
+	}
+	c := u.copy()
+	assert.Equal(t, u, c)
+
+	c.Id = "bob"
+	c.Roles[0] = "DRIVER"
+	c.Token[0] = 'T'
+	assert.Equal(t, "dave", u.Id)
+	assert.Equal(t, []string{"ADMIN"}, u.Roles, "Copies shouldn't share roles")
+	assert.Equal(t, []byte("token"), u.Token, "Copies shouldn't share the token")
+
+	assert.Nil(t, (*User)(nil).copy())
+}
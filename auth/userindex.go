@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/hailocab/gomemcache/memcache"
+
+	"github.com/hailocab/service-layer/config"
+	inst "github.com/hailocab/service-layer/instrumentation"
+	mc "github.com/hailocab/service-layer/memcache"
+)
+
+const (
+	// Prefix (after the cache key prefix) of the keys under which each user's sessions are indexed
+	userIndexKeyPrefix = "user:"
+	// How many times an index update is attempted if it races with another
+	userIndexUpdateAttempts = 3
+	// Maximum number of sessions indexed per user; those expiring soonest are dropped to make room
+	maxUserIndexSessions = 1000
+)
+
+// userIndexEnabled returns whether cached sessions are indexed by user, so that InvalidateByUser can find them
+func userIndexEnabled() bool {
+	return config.AtPath("hailo", "service", "authentication", "userIndex", "enabled").AsBool(false)
+}
+
+// userIndexKey returns the memcache key under which the sessions of userId are indexed
+func userIndexKey(userId string) string {
+	return cacheKey(userIndexKeyPrefix + userId)
+}
+
+// userIndex maps the sessIds of a user's cached sessions to when they expire (as a unix timestamp; zero if never)
+type userIndex map[string]int64
+
+// parseUserIndex decodes an index stored by format, ignoring malformed lines
+func parseUserIndex(data []byte) userIndex {
+	idx := userIndex{}
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		expiry, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		idx[parts[0]] = expiry
+	}
+	return idx
+}
+
+// format encodes the index, one "<sessId> <expiry>" line per session
+func (idx userIndex) format() []byte {
+	buf := &bytes.Buffer{}
+	for _, sessId := range idx.sessIds() {
+		fmt.Fprintf(buf, "%s %d\n", sessId, idx[sessId])
+	}
+	return buf.Bytes()
+}
+
+// sessIds returns the indexed sessIds, sorted
+func (idx userIndex) sessIds() []string {
+	sessIds := make([]string, 0, len(idx))
+	for sessId := range idx {
+		sessIds = append(sessIds, sessId)
+	}
+	sort.Strings(sessIds)
+	return sessIds
+}
+
+// prune removes sessions which expired before now, and then those expiring soonest until at most max remain
+func (idx userIndex) prune(now time.Time, max int) {
+	for sessId, expiry := range idx {
+		if expiry != 0 && expiry < now.Unix() {
+			delete(idx, sessId)
+		}
+	}
+	if len(idx) <= max {
+		return
+	}
+
+	sessIds := idx.sessIds()
+	sort.SliceStable(sessIds, func(i, j int) bool {
+		ei, ej := idx[sessIds[i]], idx[sessIds[j]]
+		return ei != 0 && (ej == 0 || ei < ej)
+	})
+	for _, sessId := range sessIds[:len(sessIds)-max] {
+		delete(idx, sessId)
+	}
+}
+
+// expiration returns the memcache expiration of the index: when its last session expires (zero if any never do)
+func (idx userIndex) expiration() int32 {
+	latest := int64(0)
+	for _, expiry := range idx {
+		if expiry == 0 {
+			return 0
+		}
+		if expiry > latest {
+			latest = expiry
+		}
+	}
+	if latest == 0 {
+		return 0
+	}
+	return mc.ExpirationAt(time.Unix(latest, 0))
+}
+
+// indexSession adds u's session to the index of its user's sessions, if indexing is enabled. The index is updated
+// with compare-and-swap, so concurrent updates for the same user don't lose sessions.
+func indexSession(u *User) error {
+	if u.Id == "" || !userIndexEnabled() {
+		return nil
+	}
+
+	expiry := int64(0)
+	if !u.ExpiryTs.IsZero() {
+		expiry = u.ExpiryTs.Unix()
+	}
+
+	key := userIndexKey(u.Id)
+	var err error
+	for i := 0; i < userIndexUpdateAttempts; i++ {
+		var it *memcache.Item
+		it, err = mc.Get(key)
+		switch err {
+		case nil:
+			idx := parseUserIndex(it.Value)
+			idx[u.SessId] = expiry
+			idx.prune(time.Now(), maxUserIndexSessions)
+			it.Value, it.Expiration = idx.format(), idx.expiration()
+			err = mc.CompareAndSwap(it)
+		case memcache.ErrCacheMiss:
+			idx := userIndex{u.SessId: expiry}
+			err = mc.Add(&memcache.Item{
+				Key:        key,
+				Value:      idx.format(),
+				Expiration: idx.expiration(),
+			})
+		}
+		if err != memcache.ErrCASConflict && err != memcache.ErrNotStored {
+			break
+		}
+	}
+	if err != nil {
+		inst.Counter(1.0, "auth.cache.userIndex.failure", 1)
+	}
+	return err
+}
+
+// InvalidateByUser invalidates all of the cached sessions of a user (eg. to force them to log out everywhere). This
+// relies on the cache's index of sessions by user, so only sessions cached whilst
+// hailo/service/authentication/userIndex/enabled was set are found. Sessions which are then presented are looked up
+// with the login service rather than trusted from the cache.
+func (c *memcacheCacher) InvalidateByUser(userId string) error {
+	t := time.Now()
+	err := c.doInvalidateByUser(userId)
+	instTiming("auth.cache.invalidateByUser", err, t)
+	return err
+}
+
+func (c *memcacheCacher) doInvalidateByUser(userId string) error {
+	key := userIndexKey(userId)
+	it, err := mc.Get(key)
+	if err == memcache.ErrCacheMiss {
+		log.Debugf("[Auth] No sessions indexed for user %s", userId)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	idx := parseUserIndex(it.Value)
+	failed := map[string]error{}
+	for _, sessId := range idx.sessIds() {
+		if err := c.Invalidate(sessId); err != nil {
+			failed[sessId] = err
+		}
+	}
+	if len(failed) > 0 {
+		// Leave the index in place so the invalidation can be retried
+		return &InvalidateByUserError{UserId: userId, Failed: failed}
+	}
+
+	log.Infof("[Auth] Invalidated %d cached sessions of user %s", len(idx), userId)
+	_, err = mc.DeleteResult(key)
+	return err
+}
+
+// InvalidateByUserError is returned by InvalidateByUser when some of the user's sessions could not be invalidated
+type InvalidateByUserError struct {
+	UserId string
+	Failed map[string]error // Keyed by sessId
+}
+
+func (e *InvalidateByUserError) Error() string {
+	sessIds := make([]string, 0, len(e.Failed))
+	for sessId := range e.Failed {
+		sessIds = append(sessIds, sessId)
+	}
+	sort.Strings(sessIds)
+	return fmt.Sprintf("Failed to invalidate %d cached sessions of user %s: %s", len(sessIds), e.UserId,
+		strings.Join(sessIds, ", "))
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserIndexRoundTrip(t *testing.T) {
+	idx := userIndex{"sess2": 1700000000, "sess1": 0}
+	data := idx.format()
+	assert.Equal(t, "sess1 0\nsess2 1700000000\n", string(data))
+	assert.Equal(t, idx, parseUserIndex(data))
+
+	assert.Equal(t, userIndex{"sess1": 5}, parseUserIndex([]byte("sess1 5\ngarbage\nsess2 notanumber\n")))
+}
+
+func TestUserIndexPrune(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	idx := userIndex{
+		"expired": now.Unix() - 1,
+		"soonest": now.Unix() + 10,
+		"later":   now.Unix() + 20,
+		"never":   0,
+	}
+	idx.prune(now, 10)
+	assert.Equal(t, userIndex{"soonest": now.Unix() + 10, "later": now.Unix() + 20, "never": 0}, idx)
+
+	idx.prune(now, 2)
+	assert.Equal(t, userIndex{"later": now.Unix() + 20, "never": 0}, idx, "Sessions expiring soonest should be dropped")
+}
+
+func TestUserIndexExpiration(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, int32(-1), userIndex{"a": 1700000010, "b": 1700000020}.expiration(),
+		"An index whose sessions have all expired should expire immediately")
+	exp := userIndex{"a": now.Unix() + 10, "b": now.Unix() + 20}.expiration()
+	assert.True(t, exp > 10 && exp <= 20, "The index should expire with its last session")
+	assert.Equal(t, int32(0), userIndex{"a": now.Unix() + 10, "b": 0}.expiration())
+	assert.Equal(t, int32(0), userIndex{}.expiration())
+}
+
+func TestInvalidateByUserError(t *testing.T) {
+	err := &InvalidateByUserError{UserId: "dave", Failed: map[string]error{
+		"sess2": errors.New("Timeout"),
+		"sess1": errors.New("Timeout"),
+	}}
+	assert.EqualError(t, err, "Failed to invalidate 2 cached sessions of user dave: sess1, sess2")
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/hailocab/protobuf/proto"
+
+	"github.com/hailocab/platform-layer/errors"
+	"github.com/hailocab/platform-layer/multiclient"
+	inst "github.com/hailocab/service-layer/instrumentation"
+
+	sessreadproto "github.com/hailocab/go-login-service/proto/readsession"
+)
+
+// Sessions are read from the login service in batches of this size when warming the cache
+const warmBatchSize = 50
+
+// multiFetcher is implemented by Cachers which can fetch many sessions in a single round-trip
+type multiFetcher interface {
+	FetchMulti(sessIds []string) (map[string]*User, error)
+}
+
+// countingMultiStorer is implemented by Cachers which can report how many of the users passed to StoreMulti were
+// actually cached (some may be skipped without error, eg. having already expired)
+type countingMultiStorer interface {
+	storeMultiCounted(users []*User) (int, error)
+}
+
+// Warm pre-populates the auth cache with the given (known-active) sessions, so that the first requests made with
+// them (eg. after a deploy) don't all fall through to the login service. Sessions which are already cached are
+// skipped; the rest are read from the login service and stored, in batches. Sessions which the login service doesn't
+// know are skipped too. A non-nil error indicates that some sessions could not be read or stored (the rest will still
+// have been cached).
+func Warm(sessIds []string) error {
+	return warm(&memcacheCacher{}, sessIds)
+}
+
+func warm(c Cacher, sessIds []string) error {
+	t := time.Now()
+	sessIds = uniqueSessIds(sessIds)
+	missing := uncachedSessIds(c, sessIds)
+
+	stored := 0
+	failed := []string{}
+	for start := 0; start < len(missing); start += warmBatchSize {
+		end := start + warmBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		users, readFailed := readSessions(missing[start:end])
+		failed = append(failed, readFailed...)
+		if len(users) == 0 {
+			continue
+		}
+
+		cached, err := storeMulti(c, users)
+		storeFailed := map[string]error{}
+		if multiErr, ok := err.(*StoreMultiError); ok {
+			storeFailed = multiErr.Failed
+		} else if err != nil {
+			for _, u := range users {
+				storeFailed[u.SessId] = err
+			}
+		}
+		for sessId, err := range storeFailed {
+			log.Warnf("[Auth] Failed to store session %s while warming cache: %v", sessId, err)
+			failed = append(failed, sessId)
+		}
+		stored += cached
+	}
+
+	var err error
+	if len(failed) > 0 {
+		err = fmt.Errorf("Failed to warm %d of %d sessions: %s", len(failed), len(sessIds), strings.Join(failed, ", "))
+	}
+	instTiming("auth.cache.warm", err, t)
+	inst.Counter(1.0, "auth.cache.warm.stored", stored)
+	log.Infof("[Auth] Warmed cache with %d sessions (%d requested, %d already cached)", stored, len(sessIds),
+		len(sessIds)-len(missing))
+	return err
+}
+
+// storeMulti stores users in c, returning how many were actually cached. Those which c skips (eg. having already
+// expired) are only excluded if c can report them (see countingMultiStorer).
+func storeMulti(c Cacher, users []*User) (int, error) {
+	if cs, ok := c.(countingMultiStorer); ok {
+		return cs.storeMultiCounted(users)
+	}
+
+	err := c.StoreMulti(users)
+	if multiErr, ok := err.(*StoreMultiError); ok {
+		return len(users) - len(multiErr.Failed), err
+	} else if err != nil {
+		return 0, err
+	}
+	return len(users), nil
+}
+
+func uniqueSessIds(sessIds []string) []string {
+	seen := make(map[string]bool, len(sessIds))
+	unique := make([]string, 0, len(sessIds))
+	for _, sessId := range sessIds {
+		if sessId != "" && !seen[sessId] {
+			seen[sessId] = true
+			unique = append(unique, sessId)
+		}
+	}
+	return unique
+}
+
+// uncachedSessIds returns those of sessIds which aren't in c. If c can't be checked, all of them are returned.
+func uncachedSessIds(c Cacher, sessIds []string) []string {
+	cached := map[string]bool{}
+	if mf, ok := c.(multiFetcher); ok {
+		users, err := mf.FetchMulti(sessIds)
+		if err != nil {
+			log.Warnf("[Auth] Error fetching sessions from cache (will warm all of them): %v", err)
+		}
+		for sessId := range users {
+			cached[sessId] = true
+		}
+	} else {
+		for _, sessId := range sessIds {
+			if _, hit, err := c.Fetch(sessId); err == nil && hit {
+				cached[sessId] = true
+			}
+		}
+	}
+
+	missing := make([]string, 0, len(sessIds))
+	for _, sessId := range sessIds {
+		if !cached[sessId] {
+			missing = append(missing, sessId)
+		}
+	}
+	return missing
+}
+
+// readSessions reads sessIds from the login service in a single batch, returning the users recovered and the sessions
+// which could not be read
+func readSessions(sessIds []string) ([]*User, []string) {
+	cl := multiclient.New().DefaultScopeFrom(multiclient.ExplicitScoper())
+	rsps := make(map[string]*sessreadproto.Response, len(sessIds))
+	for _, sessId := range sessIds {
+		rsps[sessId] = &sessreadproto.Response{}
+		cl.AddScopedReq(&multiclient.ScopedReq{
+			Uid:      sessId,
+			Service:  loginService,
+			Endpoint: readSessionEndpoint,
+			Req: &sessreadproto.Request{
+				SessId: proto.String(sessId),
+			},
+			Rsp: rsps[sessId],
+		})
+	}
+	anyErrors := cl.Execute().AnyErrors()
+
+	users := make([]*User, 0, len(sessIds))
+	failed := []string{}
+	for _, sessId := range sessIds {
+		if anyErrors {
+			if err := cl.Succeeded(sessId); err != nil {
+				if err.Type() != errors.ErrorNotFound {
+					log.Warnf("[Auth] Error reading session %s while warming cache [%s: %s] %v", sessId, err.Type(),
+						err.Code(), err.Description())
+					failed = append(failed, sessId)
+				}
+				continue
+			}
+		}
+
+		rsp := rsps[sessId]
+		if rsp.GetSessId() == "" && rsp.GetToken() == "" {
+			continue
+		}
+		u, err := FromSessionToken(rsp.GetSessId(), rsp.GetToken())
+		if err != nil {
+			log.Warnf("[Auth] Error getting user from session %s while warming cache: %v", sessId, err)
+			failed = append(failed, sessId)
+			continue
+		}
+		users = append(users, u)
+	}
+	return users, failed
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/hailocab/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/platform-layer/multiclient"
+
+	sessreadproto "github.com/hailocab/go-login-service/proto/readsession"
+)
+
+func TestWarm(t *testing.T) {
+	setupKeys()
+	cache := newTestCache()
+	cache.invalidated["cachedSessId"] = true
+
+	mock := multiclient.NewMock()
+	stub := &multiclient.Stub{
+		Service:  loginService,
+		Endpoint: readSessionEndpoint,
+		Response: &sessreadproto.Response{
+			SessId: proto.String(testSessId),
+			Token:  proto.String(testToken),
+		},
+	}
+	mock.Stub(stub)
+	multiclient.SetCaller(mock.Caller())
+
+	assert.NoError(t, warm(cache, []string{testSessId, "cachedSessId", testSessId}))
+	assert.Equal(t, 1, stub.CountCalls(), "Only the uncached session should be read, once")
+	if assert.Contains(t, cache.users, testSessId) {
+		assert.Equal(t, "dave", cache.users[testSessId].Id)
+	}
+
+	// Now everything is cached, warming again is a no-op
+	assert.NoError(t, warm(cache, []string{testSessId, "cachedSessId"}))
+	assert.Equal(t, 1, stub.CountCalls())
+}
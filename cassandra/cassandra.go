@@ -109,7 +109,7 @@ func reconnectDefault() {
 	log.Debugf("Setting Cassandra nodes %v from config", nodes)
 
 	// Set up authentication if enabled
-	if authEnabled := config.AtPath("hailo", "service", "cassandra", "authentication", "enabled").AsBool(); authEnabled {
+	if authEnabled := config.AtPath("hailo", "service", "cassandra", "authentication", "enabled").AsBool(false); authEnabled {
 
 		// Get config as json as its effectively a map[string]map[string]string
 		authconfig := config.AtPath("hailo", "service", "cassandra", "authentication", "keyspaces").AsJson()
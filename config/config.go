@@ -70,6 +70,11 @@ func SubscribeChanges() <-chan bool {
 	return DefaultInstance.SubscribeChanges()
 }
 
+// UnsubscribeChanges is a wrapper around DefaultInstance.UnsubscribeChanges
+func UnsubscribeChanges(ch <-chan bool) {
+	DefaultInstance.UnsubscribeChanges(ch)
+}
+
 // LastLoaded wraps DefaultInstance.LastLoaded
 func LastLoaded() (string, time.Time) {
 	return DefaultInstance.LastLoaded()
@@ -189,6 +194,20 @@ func (c *Config) SubscribeChanges() <-chan bool {
 	return (<-chan bool)(ch)
 }
 
+// UnsubscribeChanges stops notifications being sent to a channel yielded by SubscribeChanges. The channel is not
+// closed.
+func (c *Config) UnsubscribeChanges(sub <-chan bool) {
+	c.observersMtx.Lock()
+	defer c.observersMtx.Unlock()
+
+	for i, ch := range c.observers {
+		if (<-chan bool)(ch) == sub {
+			c.observers = append(c.observers[:i], c.observers[i+1:]...)
+			return
+		}
+	}
+}
+
 // LastLoaded will return the time we last loaded config, along with the hash
 func (c *Config) LastLoaded() (string, time.Time) {
 	data := (*configData)(atomic.LoadPointer(&c.data))
@@ -251,11 +270,11 @@ func New() *Config {
 // ConfigElement represents some specific piece of config, that we have drilled down to
 type ConfigElement interface {
 	AsString(def string) string
-	AsBool() bool
+	AsBool(def bool) bool
 	AsInt(def int) int
 	AsFloat64(def float64) float64
 	AsDuration(def string) time.Duration
-	AsStringArray() []string
+	AsStringArray(def []string) []string
 	AsHostnameArray(defPort int) []string
 	AsStringMap() map[string]string
 	AsStruct(val interface{}) error
@@ -275,10 +294,22 @@ func (c *JSONElement) AsString(def string) string {
 }
 
 // AsStringArray will retrieve an array of config values, each as a string.
-func (c *JSONElement) AsStringArray() []string {
+// A string value is treated as a comma-separated list (eg. "a, b,c"). It will
+// return the supplied default if there is no value corresponding to the
+// supplied path.
+func (c *JSONElement) AsStringArray(def []string) []string {
 	arr := make([]string, 0)
 	genericValues, err := c.Array()
 	if err != nil {
+		v, err := c.Json.String()
+		if err != nil {
+			return def
+		}
+		for _, value := range strings.Split(v, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				arr = append(arr, value)
+			}
+		}
 		return arr
 	}
 
@@ -311,7 +342,7 @@ func (c *JSONElement) AsStringMap() map[string]string {
 // is a string made up of a hostname:port. Any values defined in config
 // without a :port bit will have this automatically added.
 func (c *JSONElement) AsHostnameArray(defPort int) []string {
-	arr := c.AsStringArray()
+	arr := c.AsStringArray([]string{})
 	for i, value := range arr {
 		parts := strings.Split(value, ":")
 		if len(parts) == 1 {
@@ -322,25 +353,31 @@ func (c *JSONElement) AsHostnameArray(defPort int) []string {
 	return arr
 }
 
-// AsBool will retrieve a single config value as a string. It works with our
-// config service and will automatically interpret a string of "true" as a
-// boolean true, and treat undefined as false.
-func (c *JSONElement) AsBool() bool {
-	value := false
-
+// AsBool will retrieve a single config value as a boolean. It works with our
+// config service and will interpret (case-insensitively) strings of
+// "true"/"false", "yes"/"no" and "1"/"0", as well as the integers 1 and 0.
+// It will return the supplied default if there is no value corresponding to
+// the supplied path, or the value can't be interpreted.
+func (c *JSONElement) AsBool(def bool) bool {
 	if v, err := c.Bool(); err == nil {
-		value = v
+		return v
 	} else if v, err := c.Json.String(); err == nil {
-		if v == "true" || v == "1" {
-			value = true
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "yes", "1":
+			return true
+		case "false", "no", "0":
+			return false
 		}
 	} else if v, err := c.Json.Int(); err == nil {
-		if v == 1 {
-			value = true
+		switch v {
+		case 1:
+			return true
+		case 0:
+			return false
 		}
 	}
 
-	return value
+	return def
 }
 
 // AsInt will retrieve a single config value as an integer.
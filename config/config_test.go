@@ -46,7 +46,7 @@ func TestStringArray(t *testing.T) {
 	setupTest()
 	buf := bytes.NewBufferString(`{"configService":{"hash":["a","b","c"]}}`)
 	Load(buf)
-	a := AtPath("configService", "hash").AsStringArray()
+	a := AtPath("configService", "hash").AsStringArray(nil)
 
 	expected := []string{"a", "b", "c"}
 	if !reflect.DeepEqual(expected, a) {
@@ -54,6 +54,20 @@ func TestStringArray(t *testing.T) {
 	}
 }
 
+func TestStringArrayCommaSeparated(t *testing.T) {
+	setupTest()
+	buf := bytes.NewBufferString(`{"configService":{"hash":"a, b,,c"}}`)
+	Load(buf)
+	a := AtPath("configService", "hash").AsStringArray(nil)
+	assert.Equal(t, []string{"a", "b", "c"}, a)
+}
+
+func TestStringArrayDefault(t *testing.T) {
+	setupTest()
+	a := AtPath("configService", "hash").AsStringArray([]string{"x"})
+	assert.Equal(t, []string{"x"}, a)
+}
+
 func TestInt(t *testing.T) {
 	setupTest()
 	buf := bytes.NewBufferString(`{"configService":{"hash":42}}`)
@@ -94,7 +108,7 @@ func TestBoolBool(t *testing.T) {
 	setupTest()
 	buf := bytes.NewBufferString(`{"configService": {"someBool": true}}`)
 	Load(buf)
-	if b := AtPath("configService", "someBool").AsBool(); !b {
+	if b := AtPath("configService", "someBool").AsBool(false); !b {
 		t.Error("Expecting someBool to be true")
 	}
 }
@@ -103,7 +117,7 @@ func TestBoolDefault(t *testing.T) {
 	setupTest()
 	buf := bytes.NewBufferString(`{"configService": {"someBool": true}}`)
 	Load(buf)
-	if b := AtPath("configService", "randomThing").AsBool(); b {
+	if b := AtPath("configService", "randomThing").AsBool(false); b {
 		t.Error("Expecting randomThing to be false")
 	}
 }
@@ -112,7 +126,7 @@ func TestBoolTrueString(t *testing.T) {
 	setupTest()
 	buf := bytes.NewBufferString(`{"configService": {"someBool": "true"}}`)
 	Load(buf)
-	if b := AtPath("configService", "someBool").AsBool(); !b {
+	if b := AtPath("configService", "someBool").AsBool(false); !b {
 		t.Error("Expecting someBool ('true') to be true")
 	}
 }
@@ -121,7 +135,7 @@ func TestBoolOneString(t *testing.T) {
 	setupTest()
 	buf := bytes.NewBufferString(`{"configService": {"someBool": "1"}}`)
 	Load(buf)
-	if b := AtPath("configService", "someBool").AsBool(); !b {
+	if b := AtPath("configService", "someBool").AsBool(false); !b {
 		t.Error("Expecting someBool ('1') to be true")
 	}
 }
@@ -130,11 +144,22 @@ func TestBoolOneInt(t *testing.T) {
 	setupTest()
 	buf := bytes.NewBufferString(`{"configService": {"someBool": 1}}`)
 	Load(buf)
-	if b := AtPath("configService", "someBool").AsBool(); !b {
+	if b := AtPath("configService", "someBool").AsBool(false); !b {
 		t.Error("Expecting someBool (1) to be true")
 	}
 }
 
+func TestBoolYesNo(t *testing.T) {
+	setupTest()
+	buf := bytes.NewBufferString(`{"configService": {"yes": "YES", "no": "no", "zero": 0, "garbage": "maybe"}}`)
+	Load(buf)
+	assert.True(t, AtPath("configService", "yes").AsBool(false))
+	assert.False(t, AtPath("configService", "no").AsBool(true))
+	assert.False(t, AtPath("configService", "zero").AsBool(true))
+	assert.True(t, AtPath("configService", "garbage").AsBool(true), "Uninterpretable values should use the default")
+	assert.True(t, AtPath("configService", "missing").AsBool(true), "Missing values should use the default")
+}
+
 func TestDuration(t *testing.T) {
 	setupTest()
 	buf := bytes.NewBufferString(`{"foo": {"bar": "100ms"}}`)
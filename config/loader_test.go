@@ -45,6 +45,26 @@ func TestSubscribeChanges(t *testing.T) {
 	assert.True(t, <-updateChan, "Expecting to receive update notifcation on SubscribeChanges channel")
 }
 
+func TestUnsubscribeChanges(t *testing.T) {
+	setupTest()
+
+	ch := SubscribeChanges()
+	other := SubscribeChanges()
+	UnsubscribeChanges(ch)
+
+	Load(bytes.NewBufferString(`{"configService": {"hash": {"alpha": "b", "num": 2}}}`))
+	select {
+	case <-ch:
+		assert.Fail(t, "Expecting no update notification after unsubscribing")
+	default:
+	}
+	select {
+	case <-other:
+	default:
+		assert.Fail(t, "Expecting other subscribers to still be notified")
+	}
+}
+
 func TestSubscribeChangesTimesoutIfNoListener(t *testing.T) {
 	setupTest()
 
@@ -8,31 +8,50 @@ import (
 
 const HealthCheckId = "com.hailocab.service.tcpconn"
 
-// MaxTcpConnections inspects the number of established TCP connections are being made by this
-// process for a list of hosts. If the aggregate exceeds maxconns then an error will be raised.
+// MaxTcpConnections inspects the number of established TCP connections this process has made to a list of hosts. If
+// the aggregate exceeds maxconns then an error will be raised.
 func MaxTcpConnections(hosts []string, maxconns int) healthcheck.Checker {
 	return func() (map[string]string, error) {
-		var conns int
-		ret := make(map[string]string)
+		conns, ret := countTcpConnections(hosts)
+		if conns > maxconns {
+			return ret, fmt.Errorf("Number of connections %d exceeds threshold of %d", conns, maxconns)
+		}
 
-		for _, host := range hosts {
-			if _, ok := ret[host]; ok {
-				continue
-			}
+		return ret, nil
+	}
+}
 
-			c := proc.CachedNumRemoteTcpConns(host)
-			ret[host] = fmt.Sprintf("%d", c)
-			conns += c
+// MinTcpConnections inspects the number of established TCP connections this process has made to a list of hosts. If
+// the aggregate falls below minconns then an error will be raised.
+func MinTcpConnections(hosts []string, minconns int) healthcheck.Checker {
+	return func() (map[string]string, error) {
+		conns, ret := countTcpConnections(hosts)
+		if conns < minconns {
+			return ret, fmt.Errorf("Number of connections %d is below threshold of %d", conns, minconns)
 		}
 
-		ret["total_conns"] = fmt.Sprintf("%d", conns)
+		return ret, nil
+	}
+}
 
-		if conns > maxconns {
-			return ret, fmt.Errorf("Number of connections %d exceeds threshold of %d", conns, maxconns)
+// countTcpConnections returns the total number of established TCP connections to hosts (each counted once, however
+// many times it is listed), along with the details to report: the count for each host, and the total
+func countTcpConnections(hosts []string) (int, map[string]string) {
+	var conns int
+	ret := make(map[string]string)
+
+	for _, host := range hosts {
+		if _, ok := ret[host]; ok {
+			continue
 		}
 
-		return ret, nil
+		c := proc.CachedNumRemoteTcpConns(host)
+		ret[host] = fmt.Sprintf("%d", c)
+		conns += c
 	}
+
+	ret["total_conns"] = fmt.Sprintf("%d", conns)
+	return conns, ret
 }
 
 // TcpConnections returns all the remote hosts and the number of connections to each.
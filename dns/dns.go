@@ -2,42 +2,142 @@ package dns
 
 import (
 	"fmt"
+	"net"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/hailocab/platform-layer/util"
+
+	"github.com/hailocab/service-layer/singleflight"
 )
 
 const (
 	domain = "hailocab.net"
-	scope  = "i"
+	// DefaultScope is the scope in which roles are resolved unless another is given (the internal one)
+	DefaultScope = "i"
 )
 
 var (
-	DefaultResolver Resolver = newResolver()
+	// activeResolver is used for all lookups; access it with DefaultResolver and SetDefaultResolver
+	activeResolver Resolver = NewInstrumentedResolver(newResolver())
+	resolverMtx    sync.RWMutex
+	lookups        singleflight.Group
 )
 
-func hostName(role string) string {
-	region := util.GetAwsRegionName()
-	env := util.GetEnvironmentName()
+// SetDefaultResolver replaces the resolver used for lookups (eg. with a mock during tests, or one configured
+// differently), returning the previous resolver so that it can be restored afterwards. Wrap r with
+// NewInstrumentedResolver to keep lookups instrumented.
+func SetDefaultResolver(r Resolver) Resolver {
+	resolverMtx.Lock()
+	defer resolverMtx.Unlock()
+	prev := activeResolver
+	activeResolver = r
+	return prev
+}
+
+// DefaultResolver returns the resolver used for lookups. It's safe to call whilst the resolver may be replaced.
+func DefaultResolver() Resolver {
+	resolverMtx.RLock()
+	defer resolverMtx.RUnlock()
+	return activeResolver
+}
+
+// hostName returns the name for a role in the region and environment we are running in, in the given scope (or
+// DefaultScope if none is given)
+func hostName(role string, scope ...string) string {
+	return hostNameIn(role, util.GetAwsRegionName(), util.GetEnvironmentName(), scopeOrDefault(scope))
+}
+
+func hostNameIn(role, region, env, scope string) string {
 	return fmt.Sprintf("%s.%s.%s.%s.%s", role, region, scope, env, domain)
 }
 
-// Hosts returns a list of ip addresses for a particular role.
-func Hosts(role string) ([]string, error) {
-	name := hostName(role)
+// scopeOrDefault returns the first of scope, or DefaultScope if there is none
+func scopeOrDefault(scope []string) string {
+	if len(scope) == 0 || scope[0] == "" {
+		return DefaultScope
+	}
+	return scope[0]
+}
 
-	ips, err := DefaultResolver.LookupIP(name)
+// Result describes the outcome of resolving a role
+type Result struct {
+	Name string        // The fully-qualified name that was resolved
+	IPs  []string      // The resolved ip addresses, sorted
+	TTL  time.Duration // The record TTL, or zero if the resolver doesn't expose it
+}
+
+// Hosts returns a list of ip addresses for a particular role. The role is resolved in DefaultScope (internal
+// addressing), unless a scope is given (eg. to resolve the role's external addresses).
+func Hosts(role string, scope ...string) ([]string, error) {
+	result, err := HostsDetailed(role, scope...)
 	if err != nil {
 		return nil, err
 	}
 
-	var hosts []string
+	return result.IPs, nil
+}
+
+// HostsDetailed resolves a particular role like Hosts, but also returns the name that was resolved and (where the
+// resolver exposes it) the record TTL. As with Hosts, a scope other than DefaultScope may be given.
+func HostsDetailed(role string, scope ...string) (Result, error) {
+	return lookup(hostName(role, scope...))
+}
+
+// HostsInRegion returns a list of ip addresses for a particular role in the given region and environment, rather
+// than the ones we are running in (as used by Hosts).
+func HostsInRegion(role, region, env string) ([]string, error) {
+	result, err := lookup(hostNameIn(role, region, env, DefaultScope))
+	if err != nil {
+		return nil, err
+	}
+
+	return result.IPs, nil
+}
+
+// Resolve returns a list of ip addresses for an arbitrary (fully-qualified) name, rather than a role
+func Resolve(name string) ([]string, error) {
+	result, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.IPs, nil
+}
+
+// resolved is the outcome of a (shared) call to the resolver; ips must not be modified
+type resolved struct {
+	ips []net.IP
+	ttl time.Duration
+}
+
+func lookup(name string) (Result, error) {
+	result := Result{
+		Name: name,
+	}
+
+	// Concurrent lookups of the same name share a single call to the resolver
+	v, _, err := lookups.Do(name, func() (interface{}, error) {
+		r := DefaultResolver()
+		if ttlr, ok := r.(TTLResolver); ok {
+			ips, ttl, err := ttlr.LookupIPWithTTL(name)
+			return resolved{ips, ttl}, err
+		}
+		ips, err := r.LookupIP(name)
+		return resolved{ips: ips}, err
+	})
+	if err != nil {
+		return Result{}, err
+	}
 
-	for _, ip := range ips {
-		hosts = append(hosts, ip.String())
+	res := v.(resolved)
+	result.TTL = res.ttl
+	for _, ip := range res.ips {
+		result.IPs = append(result.IPs, ip.String())
 	}
 
-	sort.Strings(hosts)
+	sort.Strings(result.IPs)
 
-	return hosts, nil
+	return result, nil
 }
@@ -5,8 +5,10 @@ import (
 	"net"
 	"strings"
 	"testing"
+	"time"
 
 	platformtesting "github.com/hailocab/platform-layer/testing"
+	"github.com/hailocab/platform-layer/util"
 )
 
 func TestDnsHostSuite(t *testing.T) {
@@ -22,18 +24,17 @@ type DnsHostSuite struct {
 func (s *DnsHostSuite) SetupTest() {
 	s.Suite.SetupTest()
 	s.mockResolver = &MockResolver{}
-	s.realResolver = DefaultResolver
-	DefaultResolver = s.mockResolver
+	s.realResolver = SetDefaultResolver(s.mockResolver)
 }
 
 func (s *DnsHostSuite) TearDownTest() {
 	s.Suite.TearDownTest()
-	DefaultResolver = s.realResolver
+	SetDefaultResolver(s.realResolver)
 }
 
 func (s *DnsHostSuite) TestHostsKnownRole() {
 	mockResolver := &MockResolver{}
-	DefaultResolver = mockResolver
+	SetDefaultResolver(mockResolver)
 
 	// mock success response
 	mockResolver.Register("known-role", []net.IP{
@@ -56,3 +57,102 @@ func (s *DnsHostSuite) TestHostsUnknownRole() {
 	ips, err := Hosts("unknown-role")
 	s.NotNil(err, "Expected error for non existant dns record got response ips: %v err: %v", ips, err)
 }
+
+func (s *DnsHostSuite) TestHostsDetailed() {
+	s.mockResolver.Register("detailed-role", []net.IP{
+		net.ParseIP("10.0.0.2"),
+		net.ParseIP("10.0.0.1"),
+	},
+		nil)
+
+	result, err := HostsDetailed("detailed-role")
+	s.Nil(err)
+	s.Equal(hostName("detailed-role"), result.Name)
+	s.Equal([]string{"10.0.0.1", "10.0.0.2"}, result.IPs)
+	s.Equal(time.Duration(0), result.TTL)
+}
+
+func (s *DnsHostSuite) TestHostsInRegion() {
+	s.mockResolver.On("LookupIP", "known-role.us-east-1.i.staging.hailocab.net").Return([]net.IP{
+		net.ParseIP("10.1.0.1"),
+	}, nil)
+
+	ips, err := HostsInRegion("known-role", "us-east-1", "staging")
+	s.Nil(err)
+	s.Equal([]string{"10.1.0.1"}, ips)
+}
+
+func (s *DnsHostSuite) TestHostsInScope() {
+	s.mockResolver.Register("scoped-role", []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	s.mockResolver.On("LookupIP", hostNameIn("scoped-role", util.GetAwsRegionName(), util.GetEnvironmentName(), "e")).
+		Return([]net.IP{net.ParseIP("54.0.0.1")}, nil)
+
+	ips, err := Hosts("scoped-role")
+	s.Nil(err)
+	s.Equal([]string{"10.0.0.1"}, ips)
+
+	ips, err = Hosts("scoped-role", "e")
+	s.Nil(err)
+	s.Equal([]string{"54.0.0.1"}, ips)
+}
+
+func (s *DnsHostSuite) TestWatch() {
+	s.mockResolver.Register("watched-role", []net.IP{
+		net.ParseIP("10.0.0.2"),
+		net.ParseIP("10.0.0.1"),
+	}, nil)
+
+	stop := make(chan struct{})
+	ch := Watch("watched-role", 10*time.Millisecond, stop)
+
+	select {
+	case ips := <-ch:
+		s.Equal([]string{"10.0.0.1", "10.0.0.2"}, ips)
+	case <-time.After(time.Second):
+		s.Fail("Timed out waiting for initial hosts")
+	}
+
+	// Unchanged addresses are not re-sent
+	select {
+	case ips := <-ch:
+		s.Fail("Unexpected hosts update", "%v", ips)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(stop)
+	select {
+	case _, ok := <-ch:
+		s.False(ok, "Expected channel to be closed")
+	case <-time.After(time.Second):
+		s.Fail("Timed out waiting for watch to stop")
+	}
+}
+
+func (s *DnsHostSuite) TestInstrumentedResolver() {
+	s.mockResolver.Register("instrumented-role", []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	SetDefaultResolver(NewInstrumentedResolver(s.mockResolver))
+
+	_, isTTL := DefaultResolver().(TTLResolver)
+	s.False(isTTL, "Wrapping a plain Resolver should not yield a TTLResolver")
+
+	ips, err := Hosts("instrumented-role")
+	s.Nil(err)
+	s.Equal([]string{"10.0.0.1"}, ips)
+}
+
+func (s *DnsHostSuite) TestHealthCheck() {
+	s.mockResolver.Register("healthy-role", []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	s.mockResolver.Register("empty-role", []net.IP{}, nil)
+	s.mockResolver.Register("broken-role", []net.IP{}, fmt.Errorf("no such host"))
+
+	details, err := HealthCheck("healthy-role")()
+	s.Nil(err)
+	s.Equal("1", details["hosts"])
+	s.Equal(hostName("healthy-role"), details["name"])
+
+	_, err = HealthCheck("empty-role")()
+	s.EqualError(err, fmt.Sprintf("DNS lookup of %s returned no hosts", hostName("empty-role")))
+
+	_, err = HealthCheck("broken-role")()
+	s.EqualError(err, fmt.Sprintf("DNS lookup of %s failed: no such host", hostName("broken-role")))
+}
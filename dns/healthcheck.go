@@ -0,0 +1,33 @@
+package dns
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hailocab/service-layer/healthcheck"
+)
+
+const HealthCheckId = "com.hailocab.service.dns"
+
+// HealthCheck asserts our resolver can resolve the given role (which should be one that always exists) to at least one
+// host. The name resolved, the number of hosts and the lookup latency are returned in the details.
+func HealthCheck(role string) healthcheck.Checker {
+	return func() (map[string]string, error) {
+		start := time.Now()
+		result, err := HostsDetailed(role)
+		ret := map[string]string{
+			"name":    hostName(role),
+			"latency": time.Since(start).String(),
+		}
+		if err != nil {
+			return ret, fmt.Errorf("DNS lookup of %s failed: %v", ret["name"], err)
+		}
+
+		ret["hosts"] = strconv.Itoa(len(result.IPs))
+		if len(result.IPs) == 0 {
+			return ret, fmt.Errorf("DNS lookup of %s returned no hosts", ret["name"])
+		}
+		return ret, nil
+	}
+}
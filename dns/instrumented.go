@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"net"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/hailocab/service-layer/config"
+	inst "github.com/hailocab/service-layer/instrumentation"
+)
+
+const (
+	// Lookups slower than this are logged, unless overridden by hailo/service/dns/slowLookupThreshold
+	defaultSlowLookupThreshold = "500ms"
+	// Sample rate of timing events for DNS lookups
+	timingSampleRate = 0.33
+)
+
+// instrumentedResolver wraps a Resolver, recording the latency and outcome of its lookups and logging slow ones
+type instrumentedResolver struct {
+	Resolver
+}
+
+// instrumentedTTLResolver is an instrumentedResolver for a TTLResolver
+type instrumentedTTLResolver struct {
+	instrumentedResolver
+	ttlResolver TTLResolver
+}
+
+// NewInstrumentedResolver wraps r, recording the latency ("dns.lookup.success"/"dns.lookup.failure") of each lookup and
+// logging a warning for lookups slower than hailo/service/dns/slowLookupThreshold. If r is a TTLResolver, so is the
+// returned Resolver.
+func NewInstrumentedResolver(r Resolver) Resolver {
+	if ttlr, ok := r.(TTLResolver); ok {
+		return &instrumentedTTLResolver{
+			instrumentedResolver: instrumentedResolver{r},
+			ttlResolver:          ttlr,
+		}
+	}
+	return &instrumentedResolver{r}
+}
+
+func (r *instrumentedResolver) LookupIP(name string) ([]net.IP, error) {
+	start := time.Now()
+	ips, err := r.Resolver.LookupIP(name)
+	observeLookup(name, err, start)
+	return ips, err
+}
+
+func (r *instrumentedTTLResolver) LookupIPWithTTL(name string) ([]net.IP, time.Duration, error) {
+	start := time.Now()
+	ips, ttl, err := r.ttlResolver.LookupIPWithTTL(name)
+	observeLookup(name, err, start)
+	return ips, ttl, err
+}
+
+func observeLookup(name string, err error, start time.Time) {
+	d := time.Since(start)
+	if err != nil {
+		inst.Timing(timingSampleRate, "dns.lookup.failure", d)
+	} else {
+		inst.Timing(timingSampleRate, "dns.lookup.success", d)
+	}
+
+	threshold := config.AtPath("hailo", "service", "dns", "slowLookupThreshold").AsDuration(defaultSlowLookupThreshold)
+	if threshold > 0 && d > threshold {
+		log.Warnf("[DNS] Slow lookup of %s took %v (threshold %v); error: %v", name, d, threshold, err)
+	}
+}
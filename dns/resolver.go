@@ -2,12 +2,19 @@ package dns
 
 import (
 	"net"
+	"time"
 )
 
 type Resolver interface {
 	LookupIP(string) ([]net.IP, error)
 }
 
+// TTLResolver is implemented by resolvers which can also report the TTL of the records they resolve
+type TTLResolver interface {
+	Resolver
+	LookupIPWithTTL(string) ([]net.IP, time.Duration, error)
+}
+
 type resolver struct{}
 
 func (r *resolver) LookupIP(name string) ([]net.IP, error) {
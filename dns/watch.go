@@ -0,0 +1,41 @@
+package dns
+
+import (
+	"strings"
+	"time"
+)
+
+// Watch resolves a role every interval, sending its ip addresses (as returned by Hosts) on the returned channel
+// whenever they change. The first successful lookup is always sent. Failed lookups are ignored, so the last addresses
+// sent stand until the role resolves again. Watching stops, and the channel is closed, when stop is closed.
+func Watch(role string, interval time.Duration, stop <-chan struct{}) <-chan []string {
+	ch := make(chan []string, 1)
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := ""
+		sent := false
+		for {
+			if ips, err := Hosts(role); err == nil && len(ips) > 0 {
+				if key := strings.Join(ips, ","); !sent || key != last {
+					select {
+					case ch <- ips:
+						last, sent = key, true
+					case <-stop:
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,157 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BulkItem is a document to be indexed with BulkIndex
+type BulkItem struct {
+	Index string
+	Type  string // Omitted if blank (eg. for clusters without mapping types)
+	Id    string // Assigned by ElasticSearch if blank
+	Doc   interface{}
+	// If set, the document is only indexed if its version satisfies this (see Version); documents which don't are
+	// reported in the BulkError's Conflicted
+	Version Version
+}
+
+// BulkError is returned by BulkIndex when some documents could not be indexed. Documents are identified by their
+// position in the items passed to BulkIndex, as their ids may have been assigned by ElasticSearch (or repeated).
+type BulkError struct {
+	Succeeded []int          // The positions of the documents which were indexed
+	Failed    map[int]string // The positions of the documents which were not indexed, mapped to the reason
+	// The positions of the failed documents which were rejected because of a version conflict (see ErrVersionConflict)
+	Conflicted []int
+}
+
+func (e *BulkError) Error() string {
+	positions := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		positions = append(positions, i)
+	}
+	sort.Ints(positions)
+	failed := make([]string, len(positions))
+	for i, pos := range positions {
+		failed[i] = strconv.Itoa(pos)
+	}
+	return fmt.Sprintf("Bulk index failed for %d of %d documents, at positions: %s", len(e.Failed),
+		len(e.Failed)+len(e.Succeeded), strings.Join(failed, ", "))
+}
+
+// bulkResponse is the response to a _bulk request
+type bulkResponse struct {
+	Items []map[string]bulkResponseResult `json:"items"` // Keyed by action (eg. "index")
+}
+
+type bulkResponseResult struct {
+	Id     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"` // A string in older versions of ElasticSearch, an object in newer ones
+}
+
+// BulkIndex indexes the documents in a single _bulk request, returning the ids of those which were indexed (including
+// any assigned by ElasticSearch). If only some documents were indexed the error is a *BulkError, detailing those which
+// failed (so that they alone may be retried).
+func BulkIndex(items []BulkItem) ([]string, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	body, err := bulkBody(items)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := DoCommand("POST", "/_bulk", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	return parseBulkResponse(resp)
+}
+
+// bulkBody builds the body of a _bulk request indexing the items
+func bulkBody(items []BulkItem) (string, error) {
+	body := &bytes.Buffer{}
+	enc := json.NewEncoder(body) // Encode terminates each value with a newline, as the bulk API requires
+	for i, item := range items {
+		meta := item.Version.params()
+		meta["_index"] = item.Index
+		if item.Type != "" {
+			meta["_type"] = item.Type
+		}
+		if item.Id != "" {
+			meta["_id"] = item.Id
+		}
+		action := map[string]map[string]interface{}{
+			"index": meta,
+		}
+		if err := enc.Encode(action); err != nil {
+			return "", err
+		}
+		if err := enc.Encode(item.Doc); err != nil {
+			return "", fmt.Errorf("Failed to encode document %d: %v", i, err)
+		}
+	}
+	return body.String(), nil
+}
+
+// parseBulkResponse returns the ids of the documents successfully actioned, and a *BulkError if any failed. The
+// response's items are in the order of the request's.
+func parseBulkResponse(resp []byte) ([]string, error) {
+	var r bulkResponse
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return nil, fmt.Errorf("Failed to decode bulk response: %v", err)
+	}
+
+	ids := []string{}
+	var succeeded, conflicted []int
+	failed := map[int]string{}
+	for i, item := range r.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status < 300 && !result.failed() {
+				ids = append(ids, result.Id)
+				succeeded = append(succeeded, i)
+				continue
+			}
+			failed[i] = bulkErrorReason(result)
+			if result.Status == http.StatusConflict {
+				conflicted = append(conflicted, i)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return ids, &BulkError{
+			Succeeded:  succeeded,
+			Failed:     failed,
+			Conflicted: conflicted,
+		}
+	}
+	return ids, nil
+}
+
+func (r bulkResponseResult) failed() bool {
+	return len(r.Error) > 0 && string(r.Error) != "null"
+}
+
+func bulkErrorReason(result bulkResponseResult) string {
+	var reason string
+	if err := json.Unmarshal(result.Error, &reason); err == nil {
+		return reason
+	}
+
+	var structured struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(result.Error, &structured); err == nil && structured.Reason != "" {
+		return fmt.Sprintf("%s: %s", structured.Type, structured.Reason)
+	}
+
+	return fmt.Sprintf("status %d", result.Status)
+}
@@ -0,0 +1,86 @@
+package elasticsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkBody(t *testing.T) {
+	body, err := bulkBody([]BulkItem{
+		{Index: "logs", Type: "event", Id: "1", Doc: map[string]int{"n": 1}},
+		{Index: "logs", Doc: map[string]int{"n": 2}, Version: Version{IfSeqNo: 3, IfPrimaryTerm: 1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"index":{"_id":"1","_index":"logs","_type":"event"}}
+{"n":1}
+{"index":{"_index":"logs","if_primary_term":1,"if_seq_no":3}}
+{"n":2}
+`, body, "A blank id and type should be omitted")
+}
+
+func TestParseBulkResponse(t *testing.T) {
+	resp := []byte(`{"took": 3, "errors": true, "items": [
+		{"index": {"_index": "logs", "_type": "event", "_id": "1", "status": 201}},
+		{"index": {"_index": "logs", "_type": "event", "_id": "2", "status": 400,
+			"error": {"type": "mapper_parsing_exception", "reason": "failed to parse [ts]"}}},
+		{"index": {"_index": "logs", "_type": "event", "_id": "3", "status": 429,
+			"error": "EsRejectedExecutionException[rejected execution]"}}
+	]}`)
+
+	succeeded, err := parseBulkResponse(resp)
+	assert.Equal(t, []string{"1"}, succeeded)
+
+	bulkErr, ok := err.(*BulkError)
+	if assert.True(t, ok, "Expected a *BulkError, got %v", err) {
+		assert.Equal(t, []int{0}, bulkErr.Succeeded)
+		assert.Equal(t, map[int]string{
+			1: "mapper_parsing_exception: failed to parse [ts]",
+			2: "EsRejectedExecutionException[rejected execution]",
+		}, bulkErr.Failed)
+		assert.Equal(t, "Bulk index failed for 2 of 3 documents, at positions: 1, 2", bulkErr.Error())
+	}
+}
+
+func TestParseBulkResponseAssignedIds(t *testing.T) {
+	// Documents indexed without an id are assigned one, so a failure can only be identified by its position
+	resp := []byte(`{"took": 3, "errors": true, "items": [
+		{"index": {"_index": "logs", "_id": "AVx1", "status": 201}},
+		{"index": {"_index": "logs", "_id": "AVx2", "status": 429,
+			"error": "EsRejectedExecutionException[rejected execution]"}},
+		{"index": {"_index": "logs", "_id": "AVx3", "status": 201}}
+	]}`)
+
+	succeeded, err := parseBulkResponse(resp)
+	assert.Equal(t, []string{"AVx1", "AVx3"}, succeeded)
+	bulkErr, ok := err.(*BulkError)
+	if assert.True(t, ok, "Expected a *BulkError, got %v", err) {
+		assert.Equal(t, []int{0, 2}, bulkErr.Succeeded)
+		assert.Equal(t, map[int]string{1: "EsRejectedExecutionException[rejected execution]"}, bulkErr.Failed)
+	}
+}
+
+func TestParseBulkResponseSuccess(t *testing.T) {
+	resp := []byte(`{"took": 3, "errors": false, "items": [
+		{"index": {"_id": "1", "status": 201}},
+		{"index": {"_id": "2", "status": 200}}
+	]}`)
+
+	succeeded, err := parseBulkResponse(resp)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, succeeded)
+}
+
+func TestParseBulkResponseConflict(t *testing.T) {
+	resp := []byte(`{"took": 3, "errors": true, "items": [
+		{"index": {"_id": "1", "status": 201}},
+		{"index": {"_id": "2", "status": 409,
+			"error": {"type": "version_conflict_engine_exception", "reason": "[event][2]: version conflict"}}}
+	]}`)
+
+	_, err := parseBulkResponse(resp)
+	bulkErr, ok := err.(*BulkError)
+	if assert.True(t, ok, "Expected a *BulkError, got %v", err) {
+		assert.Equal(t, []int{1}, bulkErr.Conflicted)
+	}
+}
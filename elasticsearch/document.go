@@ -0,0 +1,95 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	eapi "github.com/hailocab/elastigo/api"
+)
+
+// ErrVersionConflict is returned when a write is rejected (with 409 Conflict) because the document's current version
+// doesn't match the one required
+var ErrVersionConflict = errors.New("ElasticSearch document version conflict")
+
+// Version requests optimistic concurrency control of a write: it is only applied if the document is at the given
+// version (or, with VersionType "external", if Version is greater than the document's). The zero Version applies the
+// write unconditionally.
+//
+// Clusters running ElasticSearch 6.7 or later should prefer IfSeqNo and IfPrimaryTerm (as returned by a previous read
+// or write) to internal versioning, which they deprecate. Only one scheme is sent with a request: if IfPrimaryTerm is
+// set, Version and VersionType are ignored.
+type Version struct {
+	Version     int64  // Applied if positive (and IfPrimaryTerm isn't)
+	VersionType string // eg. "external"; ElasticSearch's default (internal) if blank
+	// Applied (together) if IfPrimaryTerm is positive
+	IfSeqNo       int64
+	IfPrimaryTerm int64
+}
+
+// params returns the versioning request parameters, for sequence number and primary term if they are set, or else
+// version (ElasticSearch rejects requests combining the two)
+func (v Version) params() map[string]interface{} {
+	params := map[string]interface{}{}
+	if v.IfPrimaryTerm > 0 {
+		params["if_seq_no"] = v.IfSeqNo
+		params["if_primary_term"] = v.IfPrimaryTerm
+	} else if v.Version > 0 {
+		params["version"] = v.Version
+		if v.VersionType != "" {
+			params["version_type"] = v.VersionType
+		}
+	}
+	return params
+}
+
+// writeResponse is the response to an index or update request
+type writeResponse struct {
+	Version     int64 `json:"_version"`
+	SeqNo       int64 `json:"_seq_no"`
+	PrimaryTerm int64 `json:"_primary_term"`
+}
+
+// Index indexes doc (anything which marshals to JSON) as the document with the given id, subject to v. It returns the
+// version of the document written, which may be passed to a subsequent write to make it conditional on the document
+// not having changed in the meantime. If the document's version doesn't satisfy v, the error is ErrVersionConflict.
+func Index(index, docType, id string, doc interface{}, v Version) (Version, error) {
+	return write("PUT", docPath(index, docType, id), v, doc)
+}
+
+// Update applies partial (anything which marshals to the JSON of a partial document) to the document with the given
+// id, subject to v. Like Index, it returns the version of the document written, or ErrVersionConflict if the
+// document's version doesn't satisfy v.
+func Update(index, docType, id string, partial interface{}, v Version) (Version, error) {
+	return write("POST", docPath(index, docType, id)+"/_update", v, map[string]interface{}{"doc": partial})
+}
+
+func docPath(index, docType, id string) string {
+	return fmt.Sprintf("/%s/%s/%s", url.PathEscape(index), url.PathEscape(docType), url.PathEscape(id))
+}
+
+func write(method, path string, v Version, body interface{}) (Version, error) {
+	resp, err := DoCommand(method, path, v.params(), body)
+	if isConflict(err) {
+		return Version{}, ErrVersionConflict
+	} else if err != nil {
+		return Version{}, err
+	}
+
+	var r writeResponse
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return Version{}, fmt.Errorf("Failed to decode response to %s %s: %v", method, path, err)
+	}
+	return Version{
+		Version:       r.Version,
+		IfSeqNo:       r.SeqNo,
+		IfPrimaryTerm: r.PrimaryTerm,
+	}, nil
+}
+
+func isConflict(err error) bool {
+	esErr, ok := err.(eapi.ESError)
+	return ok && esErr.Code == http.StatusConflict
+}
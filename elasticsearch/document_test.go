@@ -0,0 +1,66 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	eapi "github.com/hailocab/elastigo/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionParams(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{}, Version{}.params())
+	assert.Equal(t, map[string]interface{}{
+		"version":      int64(3),
+		"version_type": "external",
+	}, Version{Version: 3, VersionType: "external"}.params())
+	assert.Equal(t, map[string]interface{}{
+		"if_seq_no":       int64(0),
+		"if_primary_term": int64(1),
+	}, Version{IfPrimaryTerm: 1}.params())
+	assert.Equal(t, map[string]interface{}{
+		"if_seq_no":       int64(4),
+		"if_primary_term": int64(1),
+	}, Version{Version: 3, VersionType: "external", IfSeqNo: 4, IfPrimaryTerm: 1}.params(),
+		"Only sequence number and primary term should be sent when both schemes are set")
+}
+
+func TestVersionRoundTrip(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		queries []url.Values
+	)
+	defer useTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		queries = append(queries, r.URL.Query())
+		n := len(queries)
+		fmt.Fprintf(w, `{"_version": %d, "_seq_no": %d, "_primary_term": 1}`, n, n+3)
+	}))()
+
+	v, err := Index("idx", "doc", "1", map[string]string{"a": "b"}, Version{})
+	assert.NoError(t, err)
+	assert.Equal(t, Version{Version: 1, IfSeqNo: 4, IfPrimaryTerm: 1}, v)
+
+	// Passing the returned version to the next write makes it conditional on sequence number and primary term alone
+	_, err = Update("idx", "doc", "1", map[string]string{"a": "c"}, v)
+	assert.NoError(t, err)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if assert.Len(t, queries, 2) {
+		assert.Equal(t, "", queries[0].Get("if_seq_no"))
+		assert.Equal(t, "4", queries[1].Get("if_seq_no"))
+		assert.Equal(t, "1", queries[1].Get("if_primary_term"))
+		assert.Equal(t, "", queries[1].Get("version"), "Version should not be sent alongside sequence number")
+	}
+}
+
+func TestIsConflict(t *testing.T) {
+	assert.True(t, isConflict(eapi.ESError{Code: 409}))
+	assert.False(t, isConflict(eapi.ESError{Code: 404}))
+	assert.False(t, isConflict(nil))
+}
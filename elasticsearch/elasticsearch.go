@@ -1,55 +1,282 @@
 package elasticsearch
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/cihub/seelog"
 	eapi "github.com/hailocab/elastigo/api"
 
 	"github.com/hailocab/service-layer/config"
+	"github.com/hailocab/service-layer/retry"
+)
+
+const (
+	defaultHost = "localhost:19200"
+	// How long to wait for a host to accept a connection when validating config
+	probeTimeout = time.Second
 )
 
 var (
-	once sync.Once
+	// once ensures setup is run once (until Shutdown); setupMtx protects it, along with stop and watching. initialised
+	// is set (atomically) once setup has run, so that LoadConfig needn't take setupMtx after that.
+	once        sync.Once
+	setupMtx    sync.Mutex
+	initialised int32
+	// stop is closed to stop the config watcher, which unsubscribes from config changes and marks watching done once it
+	// has exited
+	stop     chan struct{}
+	watching sync.WaitGroup
+
+	// current holds the endpoint most recently applied to elastigo
+	current atomic.Value
+	// reconfigMtx is held for writing while elastigo's (package-level) endpoint variables are updated, and for reading
+	// by requests made through DoCommand, so the two don't race
+	reconfigMtx sync.RWMutex
+
+	// configErr records why the most recent config load failed (if it did), to be surfaced by HealthCheck
+	configErr    error
+	configErrMtx sync.RWMutex
 )
 
-func setup() {
-	ch := config.SubscribeChanges()
-	go func() {
-		for {
-			<-ch
-			loadEndpointConfig()
+var (
+	errConfigNotLoaded = errors.New("Config not loaded")
+	// How long each attempt waits for config to be loaded at startup
+	configLoadTimeout = 5 * time.Second
+	// initConfigRetryPolicy governs waiting for config to be loaded at startup, so that a transient config service
+	// outage doesn't leave us with the default (localhost) config
+	initConfigRetryPolicy = retry.Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Second,
+		MaxDelay:    5 * time.Second,
+		Name:        "elasticsearch.config.init",
+	}
+)
+
+// Config describes the ElasticSearch cluster we talk to
+type Config struct {
+	Hosts    []string
+	Port     string
+	Protocol string
+}
+
+func init() {
+	current.Store(Config{})
+}
+
+// awaitConfig waits for config to be loaded, retrying with backoff (see initConfigRetryPolicy) before giving up
+func awaitConfig() error {
+	return retry.Do(context.Background(), initConfigRetryPolicy, func() error {
+		if !config.WaitUntilLoaded(configLoadTimeout) {
+			return errConfigNotLoaded
 		}
-	}()
+		return nil
+	})
+}
+
+// setup applies the config, and watches for changes to it. configErr is why config couldn't be awaited, if it wasn't
+// loaded: the defaults are then used, and the failure surfaced by HealthCheck, until it is.
+func setup(configErr error) {
+	ch := config.SubscribeChanges()
+	stop = make(chan struct{})
 
 	loadEndpointConfig()
+	if _, t := config.LastLoaded(); configErr != nil && t.IsZero() {
+		log.Errorf("[ElasticSearch] %v; using defaults until it is", configErr)
+		setConfigErr(configErr)
+	}
+
+	watching.Add(1)
+	go func(stop chan struct{}) {
+		defer watching.Done()
+		for {
+			select {
+			case <-ch:
+				loadEndpointConfig()
+			case <-stop:
+				config.UnsubscribeChanges(ch)
+				return
+			}
+		}
+	}(stop)
 }
 
 func loadEndpointConfig() {
 	log.Info("Loading ElasticSearch config")
 
+	// Only a changed endpoint is probed, as config change notifications are also sent for unrelated changes
+	ep, err := endpointFromConfig()
+	if err == nil && !reflect.DeepEqual(ep, currentEndpoint()) {
+		err = probeEndpoint(ep)
+	}
+	if err != nil {
+		prev := currentEndpoint()
+		if len(prev.Hosts) > 0 || len(ep.Hosts) == 0 {
+			log.Criticalf("[ElasticSearch] Refusing to apply invalid config: %v; keeping previous hosts %v", err,
+				prev.Hosts)
+			setConfigErr(err)
+			return
+		}
+		// There's no previous config to fall back to, so apply it anyway; the error is surfaced by HealthCheck
+		log.Errorf("[ElasticSearch] Applying config which failed validation, as there is none to keep: %v", err)
+	}
+
+	// Set these hosts in the Elasticsearch library
+	// This will initialise a host pool which uses an Epsilon Greedy algorithm to find healthy hosts
+	// and send to requests to them, and not unhealthy or slow hosts
+	reconfigMtx.Lock()
+	eapi.Port = ep.Port
+	eapi.Protocol = ep.Protocol
+	eapi.SetHosts(ep.Hosts)
+	current.Store(ep)
+	reconfigMtx.Unlock()
+
+	setConfigErr(err)
+	log.Infof("ElasticSearch hosts loaded: %v", ep.Hosts)
+}
+
+// endpointFromConfig builds the endpoint described by the current config
+func endpointFromConfig() (Config, error) {
 	port := config.AtPath("hailo", "service", "elasticsearch", "port").AsInt(9200)
 	hosts := config.AtPath("hailo", "service", "elasticsearch", "hosts").AsHostnameArray(port)
 
 	if len(hosts) == 0 {
-		hosts = append(hosts, "localhost:19200")
+		// Falling back to localhost is convenient in development, but masks misconfiguration elsewhere so it can be
+		// disabled
+		if config.AtPath("hailo", "service", "elasticsearch", "disableLocalhostFallback").AsBool(false) {
+			return Config{}, fmt.Errorf("No ElasticSearch hosts configured (localhost fallback disabled)")
+		}
+		hosts = append(hosts, defaultHost)
 	}
 
-	// Set these hosts in the Elasticsearch library
-	// This will initialise a host pool which uses an Epsilon Greedy algorithm to find healthy hosts
-	// and send to requests to them, and not unhealthy or slow hosts
-	eapi.Port = strconv.Itoa(port)
+	ep := Config{
+		Hosts:    hosts,
+		Port:     strconv.Itoa(port),
+		Protocol: "http",
+	}
 	if port == 443 {
-		eapi.Protocol = "https"
+		ep.Protocol = "https"
+	}
+	return ep, nil
+}
+
+// probeEndpoint makes a throwaway connection to each of the endpoint's hosts in turn, returning an error if none of
+// them can be reached
+func probeEndpoint(ep Config) error {
+	var err error
+	for _, host := range ep.Hosts {
+		if err = probeHost(host); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("None of the ElasticSearch hosts %v are reachable: %v", ep.Hosts, err)
+}
+
+// probeHost attempts a connection to host ("host:port"); replaceable in tests
+var probeHost = func(host string) error {
+	conn, err := net.DialTimeout("tcp", host, probeTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// ValidateConfig checks that the current config could be applied, without applying it: the config must describe at
+// least one host, and one of the hosts must accept a connection. Config reloads make the same checks, and leave
+// requests going to the previous endpoint if they fail.
+func ValidateConfig() error {
+	ep, err := endpointFromConfig()
+	if err != nil {
+		return err
 	}
-	eapi.SetHosts(hosts)
+	return probeEndpoint(ep)
+}
+
+// currentEndpoint returns the endpoint most recently applied to elastigo
+func currentEndpoint() Config {
+	return current.Load().(Config)
+}
 
-	log.Infof("ElasticSearch hosts loaded: %v", eapi.Hosts)
+// EffectiveConfig returns the config currently applied to elastigo. If the most recent config could not be applied
+// (see HealthCheck), this is the config from before that.
+func EffectiveConfig() Config {
+	LoadConfig()
+	return currentEndpoint()
+}
+
+func setConfigErr(err error) {
+	configErrMtx.Lock()
+	defer configErrMtx.Unlock()
+	configErr = err
+}
+
+func getConfigErr() error {
+	configErrMtx.RLock()
+	defer configErrMtx.RUnlock()
+	return configErr
 }
 
 // LoadConfig gets the configuration from the Config Service and modifies elastigo variables with those values.
-// setup method gets executed once and after that, there is a goroutine subscribed to any changes in the config service
+// setup method gets executed once and after that, there is a goroutine subscribed to any changes in the config service.
+// If config hasn't been loaded yet it's waited for, with retries, before falling back to the defaults.
 func LoadConfig() {
-	once.Do(setup)
+	if atomic.LoadInt32(&initialised) == 1 {
+		return
+	}
+
+	// Config may not be available yet (eg. the config service is briefly unavailable whilst we start up), so it's
+	// awaited before setting up. This is done without holding setupMtx, so that concurrent callers wait alongside one
+	// another rather than in turn.
+	err := awaitConfig()
+
+	setupMtx.Lock()
+	defer setupMtx.Unlock()
+	once.Do(func() {
+		setup(err)
+	})
+	atomic.StoreInt32(&initialised, 1)
+}
+
+// Shutdown stops watching for config changes, waiting for any reload in progress to complete. The package may be used
+// again afterwards, in which case config is loaded afresh (as on first use).
+func Shutdown() {
+	setupMtx.Lock()
+	defer setupMtx.Unlock()
+
+	atomic.StoreInt32(&initialised, 0)
+	if stop != nil {
+		close(stop)
+		stop = nil
+	}
+	watching.Wait()
+	once = sync.Once{}
+}
+
+// DoCommand makes a request to the configured cluster via elastigo (see eapi.DoCommand). Requests made this way are
+// safe to issue concurrently with a config reload; requests made through elastigo directly are not, as a reload
+// updates elastigo's package-level variables. A reload waits for in-flight requests made this way to complete.
+//
+// The latency and outcome of each request are instrumented, by operation (eg. "elasticsearch.search.success").
+func DoCommand(method, url string, args map[string]interface{}, data interface{}) ([]byte, error) {
+	LoadConfig()
+
+	start := time.Now()
+	body, err := doCommand(method, url, args, data)
+	instRequest(operation(method, url), err, start)
+	return body, err
+}
+
+// doCommand makes the request with eapi.DoCommand, holding reconfigMtx so that elastigo's endpoint variables aren't
+// updated while it reads them
+func doCommand(method, url string, args map[string]interface{}, data interface{}) ([]byte, error) {
+	reconfigMtx.RLock()
+	defer reconfigMtx.RUnlock()
+	return eapi.DoCommand(method, url, args, data)
 }
@@ -0,0 +1,189 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+	"github.com/hailocab/service-layer/retry"
+)
+
+func init() {
+	// There's no cluster to connect to in tests
+	probeHost = func(string) error { return nil }
+}
+
+// testServerConfig returns config pointing requests at the test server
+func testServerConfig(srv *httptest.Server) string {
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	return fmt.Sprintf(`{"hailo": {"service": {"elasticsearch": {"hosts": ["%s:%s"], "port": %s}}}}`, host, port, port)
+}
+
+// useTestServer configures requests to be made to a test server which serves them with h, returning a function which
+// stops it
+func useTestServer(h http.Handler) func() {
+	srv := httptest.NewServer(h)
+
+	Shutdown()
+	config.Load(bytes.NewBufferString(testServerConfig(srv)))
+	LoadConfig()
+	return func() {
+		Shutdown()
+		config.Load(bytes.NewBufferString(`{}`))
+		srv.Close()
+	}
+}
+
+// TestConcurrentReconfiguration should be run with -race
+func TestConcurrentReconfiguration(t *testing.T) {
+	var served int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&served, 1)
+		w.Write([]byte(`{"ok": true}`))
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	defer useTestServer(h)()
+	configs := []string{testServerConfig(srv), string(config.Raw())}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(cfg string) {
+			defer wg.Done()
+			config.Load(bytes.NewBufferString(cfg))
+			loadEndpointConfig()
+		}(configs[i%2])
+		go func() {
+			defer wg.Done()
+			_, err := DoCommand("GET", "/_status", nil, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(10), atomic.LoadInt32(&served), "Every request should reach one of the servers")
+}
+
+func TestReloadWaitsForRequest(t *testing.T) {
+	received, release := make(chan struct{}), make(chan struct{})
+	defer useTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+		w.Write([]byte(`{"ok": true}`))
+	}))()
+
+	requested := make(chan error, 1)
+	go func() {
+		_, err := DoCommand("GET", "/_status", nil, nil)
+		requested <- err
+	}()
+	<-received
+
+	// The reload isn't applied until the request, which is held up, completes
+	reloaded := make(chan struct{})
+	go func() {
+		config.Load(bytes.NewBufferString(`{"hailo": {"service": {"elasticsearch": {"hosts": ["es01"]}}}}`))
+		loadEndpointConfig()
+		close(reloaded)
+	}()
+	select {
+	case <-reloaded:
+		t.Fatal("Config reloaded whilst a request was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.NoError(t, <-requested)
+	<-reloaded
+	assert.Equal(t, []string{"es01:9200"}, currentEndpoint().Hosts)
+}
+
+func TestShutdown(t *testing.T) {
+	Shutdown()
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"elasticsearch": {"hosts": ["es01"]}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	LoadConfig()
+	assert.Equal(t, []string{"es01:9200"}, EffectiveConfig().Hosts)
+	Shutdown()
+
+	// Config changes are no longer picked up...
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"elasticsearch": {"hosts": ["es02"]}}}}`))
+	assert.Equal(t, []string{"es01:9200"}, currentEndpoint().Hosts)
+
+	// ...until the package is used again
+	assert.Equal(t, []string{"es02:9200"}, EffectiveConfig().Hosts)
+	Shutdown()
+}
+
+// withoutConfig runs the test with no config loaded, and a quick retry policy for awaiting it
+func withoutConfig() func() {
+	Shutdown()
+	origConfig, origPolicy, origTimeout := config.DefaultInstance, initConfigRetryPolicy, configLoadTimeout
+	config.DefaultInstance = config.New()
+	initConfigRetryPolicy = retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	configLoadTimeout = 20 * time.Millisecond
+	return func() {
+		Shutdown()
+		config.DefaultInstance, initConfigRetryPolicy, configLoadTimeout = origConfig, origPolicy, origTimeout
+		setConfigErr(nil)
+	}
+}
+
+func TestLoadConfigWaitsForConfig(t *testing.T) {
+	defer withoutConfig()()
+
+	// Config loads after the first attempt to wait for it has timed out
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		config.Load(bytes.NewBufferString(`{"hailo": {"service": {"elasticsearch": {"hosts": ["es01"]}}}}`))
+	}()
+	LoadConfig()
+	assert.Equal(t, []string{"es01:9200"}, currentEndpoint().Hosts, "Config should be applied once it loads")
+	assert.NoError(t, getConfigErr())
+}
+
+func TestLoadConfigGivesUp(t *testing.T) {
+	defer withoutConfig()()
+
+	start := time.Now()
+	LoadConfig()
+	assert.True(t, time.Since(start) >= 3*configLoadTimeout, "Each attempt should wait for config")
+	assert.Equal(t, []string{defaultHost}, currentEndpoint().Hosts, "Defaults should be used until config loads")
+	assert.Equal(t, errConfigNotLoaded, getConfigErr())
+
+	// The config is applied (and the error cleared) by the watcher
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"elasticsearch": {"hosts": ["es01"]}}}}`))
+	for i := 0; i < 100 && getConfigErr() != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(t, getConfigErr())
+	assert.Equal(t, []string{"es01:9200"}, currentEndpoint().Hosts, "Config should be applied once it loads")
+}
+
+func TestUnreachableConfigNotApplied(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"elasticsearch": {"hosts": ["es01"]}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	loadEndpointConfig()
+
+	defer func(orig func(string) error) { probeHost = orig }(probeHost)
+	probeHost = func(host string) error {
+		return fmt.Errorf("Connection refused")
+	}
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"elasticsearch": {"hosts": ["es02", "es03"]}}}}`))
+	assert.EqualError(t, ValidateConfig(), "None of the ElasticSearch hosts [es02:9200 es03:9200] are reachable: "+
+		"Connection refused")
+	loadEndpointConfig()
+	assert.Equal(t, []string{"es01:9200"}, currentEndpoint().Hosts)
+	assert.Error(t, getConfigErr())
+}
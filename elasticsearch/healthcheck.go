@@ -0,0 +1,21 @@
+package elasticsearch
+
+import (
+	"fmt"
+
+	"github.com/hailocab/service-layer/healthcheck"
+)
+
+const HealthCheckId = "com.hailocab.service.elasticsearch"
+
+// HealthCheck asserts that our ElasticSearch configuration is usable (eg. that hosts are configured, when the
+// localhost fallback is disabled)
+func HealthCheck() healthcheck.Checker {
+	return func() (map[string]string, error) {
+		LoadConfig()
+		if err := getConfigErr(); err != nil {
+			return nil, fmt.Errorf("ElasticSearch misconfigured: %v", err)
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,57 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	eapi "github.com/hailocab/elastigo/api"
+
+	inst "github.com/hailocab/service-layer/instrumentation"
+)
+
+const (
+	// Sample rate of timing events for ElasticSearch
+	timingSampleRate = 0.33
+)
+
+// operation classifies a request for instrumentation purposes (eg. "search", "bulk" or "index")
+func operation(method, url string) string {
+	path := strings.SplitN(url, "?", 2)[0]
+	switch {
+	case strings.Contains(path, "/_search"):
+		return "search"
+	case strings.Contains(path, "/_bulk"):
+		return "bulk"
+	case strings.Contains(path, "/_template"):
+		return "template"
+	}
+
+	switch method {
+	case "PUT", "POST":
+		return "index"
+	case "GET", "HEAD":
+		return "get"
+	case "DELETE":
+		return "delete"
+	default:
+		return "other"
+	}
+}
+
+// instRequest records the latency and outcome of a request. Failures are also counted by status code.
+func instRequest(op string, err error, t time.Time) {
+	key := "elasticsearch." + op
+	if err == nil {
+		inst.Timing(timingSampleRate, key+".success", time.Since(t))
+		return
+	}
+
+	inst.Timing(timingSampleRate, key+".failure", time.Since(t))
+	code := "error"
+	if esErr, ok := err.(eapi.ESError); ok && esErr.Code >= http.StatusContinue {
+		code = fmt.Sprintf("%d", esErr.Code)
+	}
+	inst.Counter(1.0, key+".status."+code, 1)
+}
@@ -0,0 +1,16 @@
+package elasticsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperation(t *testing.T) {
+	assert.Equal(t, "search", operation("POST", "/logs/_search?size=10"))
+	assert.Equal(t, "bulk", operation("POST", "/_bulk"))
+	assert.Equal(t, "template", operation("PUT", "/_template/logs"))
+	assert.Equal(t, "index", operation("PUT", "/logs/event/1"))
+	assert.Equal(t, "get", operation("GET", "/logs/event/1"))
+	assert.Equal(t, "delete", operation("DELETE", "/logs/event/1"))
+}
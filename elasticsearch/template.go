@@ -0,0 +1,163 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	eapi "github.com/hailocab/elastigo/api"
+)
+
+// EnsureTemplate makes sure the index template name exists on the configured cluster with the given body (anything
+// which marshals to the JSON of a template definition). It is idempotent: if a template already exists and matches
+// body, nothing is written. An error is returned if the existing template can't be fetched or the cluster rejects the
+// new one.
+//
+// Elasticsearch normalises templates when storing them (eg. adding defaults), so a template "matches" if every field
+// specified in body is present in the existing template with the same value. Settings are compared as Elasticsearch
+// stores them (see normaliseSettings), so they may be given in any of the forms it accepts.
+func EnsureTemplate(name string, body interface{}) error {
+	desired, err := normaliseJson(body)
+	if err != nil {
+		return fmt.Errorf("Invalid template %s: %v", name, err)
+	}
+
+	path := "/_template/" + name
+	existing, err := DoCommand("GET", path, nil, nil)
+	switch {
+	case err == nil:
+		var templates map[string]interface{}
+		if err := json.Unmarshal(existing, &templates); err != nil {
+			return fmt.Errorf("Failed to decode existing template %s: %v", name, err)
+		}
+		if tmpl, ok := templates[name]; ok && templateMatches(normaliseTemplate(tmpl), normaliseTemplate(desired)) {
+			log.Debugf("[ElasticSearch] Template %s already up to date", name)
+			return nil
+		}
+	case isNotFound(err):
+	default:
+		return fmt.Errorf("Failed to fetch template %s: %v", name, err)
+	}
+
+	if _, err := DoCommand("PUT", path, nil, body); err != nil {
+		return fmt.Errorf("Cluster rejected template %s: %v", name, err)
+	}
+	log.Infof("[ElasticSearch] Template %s updated", name)
+	return nil
+}
+
+// normaliseJson round-trips v through JSON, so it can be compared with decoded responses
+func normaliseJson(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(b, &result)
+	return result, err
+}
+
+// normaliseTemplate returns a copy of a decoded template with its settings normalised (see normaliseSettings)
+func normaliseTemplate(tmpl interface{}) interface{} {
+	t, ok := tmpl.(map[string]interface{})
+	if !ok {
+		return tmpl
+	}
+	result := make(map[string]interface{}, len(t))
+	for k, v := range t {
+		result[k] = v
+	}
+	if settings, ok := t["settings"]; ok {
+		result["settings"] = normaliseSettings(settings)
+	}
+	return result
+}
+
+// normaliseSettings returns settings in the form Elasticsearch stores them: flattened to dotted names, all under
+// "index.", with scalar values as strings. For example {"number_of_shards": 1}, {"index": {"number_of_shards": 1}}
+// and {"index.number_of_shards": "1"} all become {"index.number_of_shards": "1"}.
+func normaliseSettings(settings interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	flattenSettings("", settings, flat)
+
+	result := make(map[string]interface{}, len(flat))
+	for k, v := range flat {
+		if !strings.HasPrefix(k, "index.") {
+			k = "index." + k
+		}
+		result[k] = v
+	}
+	return result
+}
+
+func flattenSettings(prefix string, v interface{}, into map[string]interface{}) {
+	switch s := v.(type) {
+	case map[string]interface{}:
+		for k, sv := range s {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flattenSettings(k, sv, into)
+		}
+	case []interface{}:
+		values := make([]interface{}, len(s))
+		for i, sv := range s {
+			values[i] = settingString(sv)
+		}
+		into[prefix] = values
+	default:
+		into[prefix] = settingString(s)
+	}
+}
+
+// settingString returns a scalar setting as Elasticsearch returns it: as a string
+func settingString(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return fmt.Sprint(v)
+}
+
+// templateMatches returns whether every field in desired is present in existing with the same value. Scalars are
+// compared by their string representation, as Elasticsearch returns (for example) numeric settings as strings.
+func templateMatches(existing, desired interface{}) bool {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		e, ok := existing.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range d {
+			if !templateMatches(e[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		e, ok := existing.([]interface{})
+		if !ok || len(e) != len(d) {
+			return false
+		}
+		for i := range d {
+			if !templateMatches(e[i], d[i]) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return existing == nil
+	default:
+		if reflect.DeepEqual(existing, desired) {
+			return true
+		}
+		return existing != nil && fmt.Sprint(existing) == fmt.Sprint(desired)
+	}
+}
+
+func isNotFound(err error) bool {
+	esErr, ok := err.(eapi.ESError)
+	return ok && esErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,103 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateMatches(t *testing.T) {
+	existing := map[string]interface{}{
+		"order":    float64(0),
+		"template": "logs-*",
+		"settings": map[string]interface{}{
+			"number_of_shards": "3",
+		},
+		"mappings": map[string]interface{}{},
+	}
+
+	desired, err := normaliseJson(map[string]interface{}{
+		"template": "logs-*",
+		"settings": map[string]interface{}{
+			"number_of_shards": 3,
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, templateMatches(existing, desired), "Stringified settings and extra fields should match")
+
+	desired, err = normaliseJson(map[string]interface{}{
+		"template": "logs-*",
+		"settings": map[string]interface{}{
+			"number_of_shards": 5,
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, templateMatches(existing, desired), "Changed settings should not match")
+
+	desired, err = normaliseJson(map[string]interface{}{
+		"template": "metrics-*",
+	})
+	assert.NoError(t, err)
+	assert.False(t, templateMatches(existing, desired), "Changed pattern should not match")
+}
+
+func TestNormaliseSettings(t *testing.T) {
+	expected := map[string]interface{}{
+		"index.number_of_shards":   "1",
+		"index.number_of_replicas": "0",
+	}
+	for _, settings := range []string{
+		`{"number_of_shards": 1, "number_of_replicas": 0}`,
+		`{"index": {"number_of_shards": 1, "number_of_replicas": "0"}}`,
+		`{"index.number_of_shards": "1", "number_of_replicas": 0}`,
+	} {
+		var v interface{}
+		assert.NoError(t, json.Unmarshal([]byte(settings), &v))
+		assert.Equal(t, expected, normaliseSettings(v), settings)
+	}
+}
+
+// templateServer serves a template as Elasticsearch stores it, counting the PUTs it receives
+func templateServer(puts *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			atomic.AddInt32(puts, 1)
+			w.Write([]byte(`{"acknowledged": true}`))
+			return
+		}
+		w.Write([]byte(`{"logs": {
+			"order": 0,
+			"template": "logs-*",
+			"settings": {"index": {"number_of_shards": "1", "refresh_interval": "5s"}},
+			"mappings": {"log": {"properties": {"message": {"type": "string"}}}},
+			"aliases": {}
+		}}`))
+	})
+}
+
+func TestEnsureTemplateMatchesStored(t *testing.T) {
+	var puts int32
+	defer useTestServer(templateServer(&puts))()
+
+	err := EnsureTemplate("logs", map[string]interface{}{
+		"template": "logs-*",
+		"settings": map[string]interface{}{"number_of_shards": 1},
+		"mappings": map[string]interface{}{
+			"log": map[string]interface{}{
+				"properties": map[string]interface{}{"message": map[string]interface{}{"type": "string"}},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&puts), "An unchanged template shouldn't be written")
+
+	err = EnsureTemplate("logs", map[string]interface{}{
+		"template": "logs-*",
+		"settings": map[string]interface{}{"number_of_shards": 2},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&puts), "A changed template should be written")
+}
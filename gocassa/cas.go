@@ -0,0 +1,70 @@
+package gocassa
+
+import (
+	"context"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/gocql/gocql"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+// serialConsistencyConfig returns the serial consistency of the keyspace's lightweight transactions: that set for the
+// keyspace (hailo/service/cassandra/serialConsistency/<ks>), otherwise the default (defaults/serialConsistencyLevel),
+// otherwise SERIAL. LOCAL_SERIAL confines each transaction's Paxos round to the local datacentre; in multi-DC
+// deployments this avoids a cross-DC round trip per transaction, but transactions in different datacentres are then
+// only serialised with each other if all writes to the data are themselves made with LOCAL_SERIAL in one datacentre.
+func serialConsistencyConfig(ks string) gocql.SerialConsistency {
+	clStr := config.AtPath("hailo", "service", "cassandra", "serialConsistency", ks).AsString("")
+	if clStr == "" {
+		clStr = config.AtPath("hailo", "service", "cassandra", "defaults", "serialConsistencyLevel").AsString("")
+	}
+	if cl := serialClFromString(clStr); cl != 0 {
+		return cl
+	}
+	return gocql.Serial
+}
+
+// ExecuteCAS executes a conditional statement (a lightweight transaction, eg. "INSERT ... IF NOT EXISTS" or
+// "UPDATE ... IF version = ?"), returning whether it was applied. If it wasn't, existing holds the current values of
+// the columns in the condition. The statement is executed at the keyspace's write consistency, with its Paxos phase at
+// the keyspace's serial consistency.
+func (e *gocqlExecutor) ExecuteCAS(ctx context.Context, stmt string, params ...interface{}) (applied bool,
+	existing map[string]interface{}, err error) {
+
+	if err := e.init(); err != nil {
+		return false, nil, err
+	}
+
+	start := time.Now()
+	session, cfg, done := e.sessionWithConfig()
+	defer done()
+	ks := cfg.ks
+
+	release, err := cfg.limiter.acquire(ctx, waitDeadline(ctx))
+	if err != nil {
+		instTiming(ks, "cas", err, start)
+		return false, nil, err
+	}
+	defer release()
+
+	q := sampleTrace(ctx, session.Query(stmt, params...).WithContext(ctx), session, cfg).Consistency(cfg.writeCl).
+		SerialConsistency(cfg.serialCl)
+	existing = map[string]interface{}{}
+	applied, err = q.MapScanCAS(existing)
+	err = classifyErr(err)
+	instTiming(ks, "cas", err, start)
+	instStatementTiming(ks, stmt, err, start)
+	observeCheckoutTimeout(ks, err)
+	observeSlow(ctx, cfg, stmt, time.Since(start))
+	if err == nil && !applied {
+		instCounter(ks, "cas.notApplied")
+	}
+	log.Tracef("%s CAS took %s (applied=%v): %s", logPrefix(ctx, ks), time.Since(start).String(), applied,
+		cfg.loggable(stmt))
+	if applied || err != nil {
+		existing = nil
+	}
+	return applied, existing, err
+}
@@ -1,39 +1,151 @@
 package gocassa
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
+	"net"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/cihub/seelog"
 	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/lz4"
 	"github.com/hailocab/go-hostpool"
 
 	"github.com/hailocab/service-layer/config"
 	"github.com/hailocab/service-layer/dns"
+	"github.com/hailocab/service-layer/retry"
 )
 
 var (
 	defaultPort  = 9042
 	defaultHosts = []string{"localhost:" + strconv.Itoa(defaultPort)}
 	defaultTier  = "general"
+	// Compression used for CQL connections unless overridden by hailo/service/cassandra/compression (one of "snappy",
+	// "lz4" or "none")
+	defaultCompression = "snappy"
+	// How long the epsilon-greedy host pool takes to forget about a host's performance (and so re-explore down-weighted
+	// hosts), unless overridden by hailo/service/cassandra/defaults/hostPoolDecay
+	defaultHostPoolDecay = "5m"
+	// Constructs the epsilon-greedy host pool (replaced in tests)
+	newEpsilonGreedy = hostpool.NewEpsilonGreedy
 )
 
+// How long getKsConfig (and each of awaitConfig's attempts) waits for config to be loaded
+var configLoadTimeout = 5 * time.Second
+
+// errConfigNotLoaded is returned by getKsConfig if config wasn't loaded in time (eg. the config service is briefly
+// unavailable)
+var errConfigNotLoaded = errors.New("Config not loaded")
+
+// initConfigRetryPolicy governs waiting for config to be loaded when an executor is initialised, so that a transient
+// config service outage at startup doesn't fail it immediately
+var initConfigRetryPolicy = retry.Policy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    5 * time.Second,
+	Name:        "cassandra.config.init",
+}
+
+// awaitConfig waits for config to be loaded, retrying with backoff (see initConfigRetryPolicy) before failing with
+// errConfigNotLoaded
+func awaitConfig() error {
+	return retry.Do(context.Background(), initConfigRetryPolicy, func() error {
+		if !config.WaitUntilLoaded(configLoadTimeout) {
+			return errConfigNotLoaded
+		}
+		return nil
+	})
+}
+
+var (
+	clusterConfigurers    = map[string]func(*gocql.ClusterConfig){}
+	clusterConfigurersMtx sync.RWMutex
+)
+
+// RegisterClusterConfigurer registers a function which is called to modify the named keyspace's gocql ClusterConfig
+// immediately before each session is created, replacing any existing one. This is an escape hatch for gocql settings
+// not otherwise exposed through config (eg. the reconnection policy). It takes effect the next time a session is
+// created. Passing nil removes the configurer.
+func RegisterClusterConfigurer(ks string, configure func(*gocql.ClusterConfig)) {
+	clusterConfigurersMtx.Lock()
+	defer clusterConfigurersMtx.Unlock()
+	if configure == nil {
+		delete(clusterConfigurers, ks)
+		return
+	}
+	clusterConfigurers[ks] = configure
+}
+
+// configureCluster applies the keyspace's registered configurer (if any) to cc
+func configureCluster(ks string, cc *gocql.ClusterConfig) {
+	clusterConfigurersMtx.RLock()
+	configure, ok := clusterConfigurers[ks]
+	clusterConfigurersMtx.RUnlock()
+	if ok {
+		configure(cc)
+	}
+}
+
 // ksConfig represents an (immutable) keyspace configuration.
 type ksConfig struct {
-	ks       string
-	hosts    []string
-	username string
-	password string
-	retries  int
-	cl       gocql.Consistency
-	timeout  time.Duration
-	cc       *gocql.ClusterConfig
+	ks          string
+	hosts       []string
+	username    string
+	password    string
+	retries     int
+	retryBudget int
+	maxRows     int
+	maxBatch    int // Maximum number of statements in an atomic batch (zero is unlimited)
+	cl          gocql.Consistency
+	read        readPolicy        // Used by queries
+	writeCl     gocql.Consistency // Used by statements and batches; defaults to cl
+	pingCl      gocql.Consistency // Used by Ping, and hence the ping healthchecks; defaults to LocalOne
+	timeout     time.Duration
+	compression string
+	traceRate   float64       // Fraction (0-1) of queries for which a trace is captured and logged
+	slow        time.Duration // Statements taking longer than this are logged at WARN (zero disables this)
+	concurrency int           // Maximum number of queries in flight at once (zero is unlimited)
+	fair        bool          // If set, queries waiting for one of the concurrency slots are served in arrival order
+	decay       time.Duration // Decay duration of the epsilon-greedy host pool
+	// Speculative execution of idempotent reads: if no response has been received after specDelay, up to specAttempts
+	// further requests are sent to other hosts (each after a further specDelay)
+	specDelay    time.Duration
+	specAttempts int
+	// If set, the cluster is probed when the executor is initialised, and initialisation fails if it can't be reached
+	// (rather than failures surfacing with the first query)
+	failFastOnInit bool
+	// If set, the driver assigns each statement's write timestamp (requires protoVersion 3 or later), so that the
+	// order of writes doesn't depend on the clocks of whichever coordinators they happen to reach
+	clientTimestamps bool
+	// Consistency of the Paxos phase of lightweight transactions (eg. ExecuteCAS); defaults to SERIAL
+	serialCl gocql.SerialConsistency
+	// If redact is set, statements are logged with their literal values masked, and the names of redactColumns replaced
+	redact        bool
+	redactColumns []string
+	redactPattern *regexp.Regexp // Matches redactColumns (nil if there are none)
+	// If downgrade is set, once downgradeAfter consecutive reads have failed because not enough replicas were
+	// available, reads are retried at downgradeCl (accepting that they may return stale data)
+	downgrade      bool
+	downgradeCl    gocql.Consistency
+	downgradeAfter int
+	tls            tlsOptions
+	localDc        string              // If set, hosts in this datacentre are preferred (see dcHostPool)
+	dcs            map[string]string   // Host address to datacentre
+	limiter        *concurrencyLimiter // Only set once the config is applied (see withLimiter)
+	cc             *gocql.ClusterConfig
+	// The host pool is only built once the config is applied (see withHostPool); both are nil until then, and for
+	// single-host configs. hostPool is nil unless hosts are selected epsilon-greedily.
+	pool     hostpool.HostPool
+	hostPool *observedHostPool
 }
 
 // hash returns a hashsum of the contents, used to determine if configuration has changed
@@ -42,8 +154,46 @@ func (c ksConfig) hash() uint32 {
 	io.WriteString(hasher, c.username)
 	io.WriteString(hasher, c.password)
 	io.WriteString(hasher, strconv.Itoa(c.retries))
+	io.WriteString(hasher, strconv.Itoa(c.retryBudget))
+	io.WriteString(hasher, strconv.Itoa(c.maxRows))
+	io.WriteString(hasher, strconv.Itoa(c.maxBatch))
 	io.WriteString(hasher, strconv.Itoa(int(c.cl)))
+	io.WriteString(hasher, strconv.Itoa(int(c.read.cl)))
+	io.WriteString(hasher, strconv.Itoa(int(c.read.serialCl)))
+	io.WriteString(hasher, strconv.Itoa(c.read.retries))
+	io.WriteString(hasher, strconv.Itoa(int(c.writeCl)))
+	io.WriteString(hasher, strconv.Itoa(int(c.serialCl)))
+	io.WriteString(hasher, strconv.Itoa(int(c.pingCl)))
 	io.WriteString(hasher, strconv.Itoa(int(c.timeout.Nanoseconds())))
+	io.WriteString(hasher, c.compression)
+	io.WriteString(hasher, strconv.FormatFloat(c.traceRate, 'f', -1, 64))
+	io.WriteString(hasher, strconv.Itoa(int(c.slow.Nanoseconds())))
+	io.WriteString(hasher, strconv.Itoa(c.concurrency))
+	io.WriteString(hasher, strconv.FormatBool(c.fair))
+	io.WriteString(hasher, strconv.Itoa(int(c.decay.Nanoseconds())))
+	io.WriteString(hasher, strconv.Itoa(int(c.specDelay.Nanoseconds())))
+	io.WriteString(hasher, strconv.Itoa(c.specAttempts))
+	io.WriteString(hasher, strconv.FormatBool(c.redact))
+	io.WriteString(hasher, strconv.FormatBool(c.clientTimestamps))
+	io.WriteString(hasher, strings.Join(c.redactColumns, ","))
+	io.WriteString(hasher, strconv.FormatBool(c.downgrade))
+	io.WriteString(hasher, strconv.Itoa(int(c.downgradeCl)))
+	io.WriteString(hasher, strconv.Itoa(c.downgradeAfter))
+	io.WriteString(hasher, strconv.FormatBool(c.tls.enabled))
+	io.WriteString(hasher, c.tls.caPath)
+	io.WriteString(hasher, c.tls.certPath)
+	io.WriteString(hasher, c.tls.keyPath)
+	io.WriteString(hasher, c.tls.serverName)
+	io.WriteString(hasher, strconv.FormatBool(c.tls.insecure))
+	io.WriteString(hasher, c.localDc)
+	dcHosts := make([]string, 0, len(c.dcs))
+	for h := range c.dcs {
+		dcHosts = append(dcHosts, h)
+	}
+	sort.Strings(dcHosts)
+	for _, h := range dcHosts {
+		io.WriteString(hasher, h+"="+c.dcs[h])
+	}
 	for _, h := range sort.StringSlice(c.hosts) { // Ordering variations are insignificant
 		io.WriteString(hasher, h)
 	}
@@ -62,10 +212,211 @@ func (c ksConfig) String() string {
 		result = append(result, "password=***")
 	}
 	result = append(result, fmt.Sprintf("retries=%d", c.retries))
+	if c.retryBudget > 0 {
+		result = append(result, fmt.Sprintf("retryBudget=%d/s", c.retryBudget))
+	}
+	if c.maxRows > 0 {
+		result = append(result, fmt.Sprintf("maxRows=%d", c.maxRows))
+	}
+	if c.maxBatch > 0 {
+		result = append(result, fmt.Sprintf("maxBatchStatements=%d", c.maxBatch))
+	}
+	result = append(result, fmt.Sprintf("readConsistency=%s", c.read.cl.String()))
+	if c.read.serialCl != 0 {
+		result = append(result, fmt.Sprintf("readSerialConsistency=%s", c.read.serialCl.String()))
+	}
+	if c.read.retries != c.retries {
+		result = append(result, fmt.Sprintf("readRetries=%d", c.read.retries))
+	}
+	result = append(result, fmt.Sprintf("writeConsistency=%s", c.writeCl.String()))
+	result = append(result, fmt.Sprintf("serialConsistency=%s", c.serialCl.String()))
+	result = append(result, fmt.Sprintf("healthCheckConsistency=%s", c.pingCl.String()))
 	result = append(result, fmt.Sprintf("timeout=%s", c.timeout.String()))
+	result = append(result, fmt.Sprintf("compression=%s", c.compression))
+	if c.traceRate > 0 {
+		result = append(result, fmt.Sprintf("traceSampleRate=%v", c.traceRate))
+	}
+	if c.slow > 0 {
+		result = append(result, fmt.Sprintf("slowQueryThreshold=%s", c.slow.String()))
+	}
+	if c.concurrency > 0 {
+		result = append(result, fmt.Sprintf("maxConcurrentQueries=%d", c.concurrency))
+		if c.fair {
+			result = append(result, "fairQueueing")
+		}
+	}
+	if c.localDc != "" {
+		result = append(result, fmt.Sprintf("localDatacentre=%s", c.localDc))
+	} else {
+		result = append(result, fmt.Sprintf("hostPoolDecay=%s", c.decay.String()))
+	}
+	if c.speculative() {
+		result = append(result, fmt.Sprintf("speculativeExecution=%dx%s", c.specAttempts, c.specDelay.String()))
+	}
+	if c.failFastOnInit {
+		result = append(result, "failFastOnInit")
+	}
+	if c.clientTimestamps {
+		result = append(result, "clientTimestamps")
+	}
+	if c.redact {
+		result = append(result, fmt.Sprintf("redact=%v", c.redactColumns))
+	}
+	if c.downgrade {
+		result = append(result, fmt.Sprintf("consistencyDowngrade=%s after %d unavailable", c.downgradeCl.String(),
+			c.downgradeAfter))
+	}
+	if c.tls.enabled {
+		result = append(result, c.tls.String())
+	}
 	return strings.Join(result, "; ")
 }
 
+// loggable returns stmt in a form which may be logged: redacted, if so configured for the keyspace
+func (c ksConfig) loggable(stmt string) string {
+	if !c.redact {
+		return stmt
+	}
+	return redact(stmt, c.redactPattern)
+}
+
+// speculative returns whether idempotent reads should be speculatively executed
+func (c ksConfig) speculative() bool {
+	return c.specAttempts > 0 && c.specDelay > 0
+}
+
+// validate checks the config is sensible, returning a descriptive error naming the offending field if not
+func (c ksConfig) validate() error {
+	switch {
+	case len(c.hosts) == 0:
+		return fmt.Errorf("Invalid config for keyspace %s: no hosts", c.ks)
+	case c.timeout <= 0:
+		return fmt.Errorf("Invalid config for keyspace %s: recvTimeout must be positive (got %s)", c.ks, c.timeout.String())
+	case c.maxBatch < 0:
+		return fmt.Errorf("Invalid config for keyspace %s: maxBatchStatements must not be negative (got %d)", c.ks,
+			c.maxBatch)
+	case c.slow < 0:
+		return fmt.Errorf("Invalid config for keyspace %s: slowQueryThreshold must not be negative (got %s)", c.ks,
+			c.slow.String())
+	case c.retries < 0:
+		return fmt.Errorf("Invalid config for keyspace %s: maxRetries must not be negative (got %d)", c.ks, c.retries)
+	case c.cc == nil:
+		return fmt.Errorf("Invalid config for keyspace %s: no cluster config", c.ks)
+	case c.cc.NumConns <= 0:
+		return fmt.Errorf("Invalid config for keyspace %s: maxHostConns must be positive (got %d)", c.ks, c.cc.NumConns)
+	case c.cl > gocql.LocalOne:
+		return fmt.Errorf("Invalid config for keyspace %s: unknown consistencyLevel %d", c.ks, c.cl)
+	case c.read.cl > gocql.LocalOne:
+		return fmt.Errorf("Invalid config for keyspace %s: unknown readConsistencyLevel %d", c.ks, c.read.cl)
+	case c.read.serialCl != 0 && c.read.serialCl != gocql.Serial && c.read.serialCl != gocql.LocalSerial:
+		return fmt.Errorf("Invalid config for keyspace %s: unknown read serialConsistencyLevel %d", c.ks,
+			c.read.serialCl)
+	case c.read.retries < 0:
+		return fmt.Errorf("Invalid config for keyspace %s: read maxRetries must not be negative (got %d)", c.ks,
+			c.read.retries)
+	case c.writeCl > gocql.LocalOne:
+		return fmt.Errorf("Invalid config for keyspace %s: unknown writeConsistencyLevel %d", c.ks, c.writeCl)
+	case c.serialCl != gocql.Serial && c.serialCl != gocql.LocalSerial:
+		return fmt.Errorf("Invalid config for keyspace %s: unknown serialConsistencyLevel %d", c.ks, c.serialCl)
+	case c.pingCl > gocql.LocalOne:
+		return fmt.Errorf("Invalid config for keyspace %s: unknown healthCheckConsistencyLevel %d", c.ks, c.pingCl)
+	case c.clientTimestamps && c.cc.ProtoVersion < 3:
+		return fmt.Errorf("Invalid config for keyspace %s: clientTimestamps requires protoVersion 3 or later (got %d)",
+			c.ks, c.cc.ProtoVersion)
+	case c.downgrade && c.downgradeCl > gocql.LocalOne:
+		return fmt.Errorf("Invalid config for keyspace %s: unknown consistencyDowngrade consistencyLevel %d", c.ks,
+			c.downgradeCl)
+	case c.downgrade && c.downgradeAfter <= 0:
+		return fmt.Errorf("Invalid config for keyspace %s: consistencyDowngrade afterUnavailable must be positive "+
+			"(got %d)", c.ks, c.downgradeAfter)
+	case c.tls.enabled && (c.tls.certPath == "") != (c.tls.keyPath == ""):
+		return fmt.Errorf("Invalid config for keyspace %s: tls certPath and keyPath must be set together", c.ks)
+	case c.localDc != "" && !c.hasDcHosts():
+		return fmt.Errorf("Invalid config for keyspace %s: no hosts are mapped to localDatacentre %s", c.ks,
+			c.localDc)
+	}
+	for _, h := range c.hosts {
+		if strings.TrimSpace(h) == "" {
+			return fmt.Errorf("Invalid config for keyspace %s: empty host in %v", c.ks, c.hosts)
+		}
+	}
+	return nil
+}
+
+// Config describes the settings applied to a keyspace's session (excluding sensitive data)
+type Config struct {
+	Keyspace         string
+	Hosts            []string
+	Username         string
+	Retries          int
+	RetryBudget      int
+	MaxRows          int
+	MaxBatch         int
+	Consistency      gocql.Consistency
+	ReadConsistency  gocql.Consistency
+	ReadSerial       gocql.SerialConsistency // If set, reads are made at this instead of ReadConsistency
+	ReadRetries      int
+	WriteConsistency gocql.Consistency
+	PingConsistency  gocql.Consistency
+	Timeout          time.Duration
+	Compression      string
+	TraceSampleRate  float64
+	SlowThreshold    time.Duration // Zero if slow statements aren't logged
+	MaxConcurrent    int
+	FairQueueing     bool
+	HostPoolDecay    time.Duration
+	// Speculative execution of idempotent reads (disabled if either is zero)
+	SpeculativeDelay    time.Duration
+	SpeculativeAttempts int
+	FailFastOnInit      bool
+	ClientTimestamps    bool
+	// Consistency at which reads are retried once DowngradeAfter consecutive reads have been unavailable (disabled if
+	// DowngradeAfter is zero)
+	DowngradeConsistency gocql.Consistency
+	DowngradeAfter       int
+	SerialConsistency    gocql.SerialConsistency
+	TLS                  bool
+	LocalDatacentre      string // If set, hosts in this datacentre are preferred (and HostPoolDecay doesn't apply)
+}
+
+// effective returns the public description of the config
+func (c ksConfig) effective() Config {
+	cfg := Config{
+		Keyspace:            c.ks,
+		Hosts:               append([]string(nil), c.hosts...),
+		Username:            c.username,
+		Retries:             c.retries,
+		RetryBudget:         c.retryBudget,
+		MaxRows:             c.maxRows,
+		MaxBatch:            c.maxBatch,
+		Consistency:         c.cl,
+		ReadConsistency:     c.read.cl,
+		WriteConsistency:    c.writeCl,
+		PingConsistency:     c.pingCl,
+		Timeout:             c.timeout,
+		Compression:         c.compression,
+		TraceSampleRate:     c.traceRate,
+		SlowThreshold:       c.slow,
+		MaxConcurrent:       c.concurrency,
+		FairQueueing:        c.fair,
+		HostPoolDecay:       c.decay,
+		SpeculativeDelay:    c.specDelay,
+		SpeculativeAttempts: c.specAttempts,
+		FailFastOnInit:      c.failFastOnInit,
+		ClientTimestamps:    c.clientTimestamps,
+	}
+	if c.downgrade {
+		cfg.DowngradeConsistency = c.downgradeCl
+		cfg.DowngradeAfter = c.downgradeAfter
+	}
+	cfg.SerialConsistency = c.serialCl
+	cfg.ReadSerial = c.read.serialCl
+	cfg.ReadRetries = c.read.retries
+	cfg.TLS = c.tls.enabled
+	cfg.LocalDatacentre = c.localDc
+	return cfg
+}
+
 func clFromString(clStr string) gocql.Consistency {
 	switch strings.ToLower(clStr) {
 	case "any":
@@ -91,9 +442,33 @@ func clFromString(clStr string) gocql.Consistency {
 	}
 }
 
+// clOrDefault returns the consistency named by clStr, or def if it is unset
+func clOrDefault(clStr string, def gocql.Consistency) gocql.Consistency {
+	if clStr == "" {
+		return def
+	}
+	return clFromString(clStr)
+}
+
+// compressorFromString maps a compression name from config onto a gocql Compressor. A nil Compressor disables
+// compression.
+func compressorFromString(compression string) gocql.Compressor {
+	switch strings.ToLower(compression) {
+	case "none", "off":
+		return nil
+	case "lz4":
+		return lz4.LZ4Compressor{}
+	case "snappy":
+		return gocql.SnappyCompressor{}
+	default:
+		log.Warnf("[Cassandra] Unknown compression %q; defaulting to %s", compression, defaultCompression)
+		return gocql.SnappyCompressor{}
+	}
+}
+
 func getKsConfig(ks string) (ksConfig, error) {
-	if !config.WaitUntilLoaded(5 * time.Second) {
-		return ksConfig{}, fmt.Errorf("Config not loaded")
+	if !config.WaitUntilLoaded(configLoadTimeout) {
+		return ksConfig{}, errConfigNotLoaded
 	}
 
 	username, password, err := ksAuth(ks)
@@ -101,20 +476,54 @@ func getKsConfig(ks string) (ksConfig, error) {
 		return ksConfig{}, err
 	}
 
+	hosts := getHosts()
+	if pinHostIPs() {
+		hosts = pinHosts(hosts)
+	}
+
 	c := ksConfig{
-		ks:       ks,
-		hosts:    getHosts(),
-		username: username,
-		password: password,
-		retries:  config.AtPath("hailo", "service", "cassandra", "defaults", "maxRetries").AsInt(5),
-		cl:       clFromString(config.AtPath("hailo", "service", "cassandra", "defaults", "consistencyLevel").AsString("")),
-		timeout:  config.AtPath("hailo", "service", "cassandra", "defaults", "recvTimeout").AsDuration("1s"),
+		ks:          ks,
+		hosts:       hosts,
+		username:    username,
+		password:    password,
+		retries:     config.AtPath("hailo", "service", "cassandra", "defaults", "maxRetries").AsInt(5),
+		retryBudget: config.AtPath("hailo", "service", "cassandra", "defaults", "retryBudget").AsInt(0),
+		maxRows:     config.AtPath("hailo", "service", "cassandra", "defaults", "maxRows").AsInt(0),
+		maxBatch:    config.AtPath("hailo", "service", "cassandra", "defaults", "maxBatchStatements").AsInt(0),
+		cl:          clFromString(config.AtPath("hailo", "service", "cassandra", "defaults", "consistencyLevel").AsString("")),
+		timeout:     config.AtPath("hailo", "service", "cassandra", "defaults", "recvTimeout").AsDuration("1s"),
+		compression: config.AtPath("hailo", "service", "cassandra", "compression").AsString(defaultCompression),
+		traceRate:   config.AtPath("hailo", "service", "cassandra", "defaults", "traceSampleRate").AsFloat64(0),
+		concurrency: config.AtPath("hailo", "service", "cassandra", "defaults", "maxConcurrentQueries").AsInt(0),
+		decay:       config.AtPath("hailo", "service", "cassandra", "defaults", "hostPoolDecay").AsDuration(defaultHostPoolDecay),
 	}
+	c.specDelay = config.AtPath("hailo", "service", "cassandra", "defaults", "speculativeExecution", "delay").
+		AsDuration("0")
+	c.specAttempts = config.AtPath("hailo", "service", "cassandra", "defaults", "speculativeExecution", "attempts").
+		AsInt(0)
+	c.redact, c.redactColumns = redactionConfig(ks)
+	c.redactPattern = columnsPattern(c.redactColumns)
+	c.downgrade, c.downgradeCl, c.downgradeAfter = downgradeConfig(ks)
+	c.slow = config.AtPath("hailo", "service", "cassandra", "defaults", "slowQueryThreshold").AsDuration("0")
+	c.tls = tlsConfig()
+	c.localDc, c.dcs = datacentreConfig()
+	c.failFastOnInit = config.AtPath("hailo", "service", "cassandra", "defaults", "failFastOnInit").AsBool(false)
+	c.clientTimestamps = config.AtPath("hailo", "service", "cassandra", "defaults", "clientTimestamps").AsBool(false)
+	c.fair = config.AtPath("hailo", "service", "cassandra", "defaults", "fairQueueing").AsBool(false)
+	c.read = readPolicyConfig(c.cl, c.retries)
+	c.serialCl = serialConsistencyConfig(ks)
+	c.writeCl = clOrDefault(config.AtPath("hailo", "service", "cassandra", "defaults", "writeConsistencyLevel").AsString(""),
+		c.cl)
+	c.pingCl = clOrDefault(config.AtPath("hailo", "service", "cassandra", "defaults", "healthCheckConsistencyLevel").
+		AsString(""), gocql.LocalOne)
 	cc := gocql.NewCluster(c.hosts...)
 	cc.ProtoVersion = config.AtPath("hailo", "service", "cassandra", "defaults", "protoVersion").AsInt(2)
 	cc.Consistency = c.cl
-	cc.Compressor = gocql.SnappyCompressor{}
+	cc.SerialConsistency = c.serialCl
+	cc.DefaultTimestamp = c.clientTimestamps
+	cc.Compressor = compressorFromString(c.compression)
 	cc.DiscoverHosts = false
+	cc.SslOpts = c.tls.sslOptions()
 	cc.NumConns = config.AtPath("hailo", "service", "cassandra", "defaults", "maxHostConns").AsInt(2)
 	cc.Authenticator = gocql.PasswordAuthenticator{
 		Username: c.username,
@@ -122,18 +531,61 @@ func getKsConfig(ks string) (ksConfig, error) {
 	}
 	cc.Timeout = c.timeout
 	cc.Keyspace = c.ks
-	cc.RetryPolicy = &gocql.SimpleRetryPolicy{
-		NumRetries: c.retries,
+	budget := retryBudgetFor(c.ks, c.retryBudget)
+	cc.RetryPolicy = &budgetedRetryPolicy{
+		RetryPolicy: &gocql.SimpleRetryPolicy{
+			NumRetries: c.retries,
+		},
+		ks:     c.ks,
+		budget: budget,
+	}
+	c.read.retryPolicy = &budgetedRetryPolicy{
+		RetryPolicy: &gocql.SimpleRetryPolicy{
+			NumRetries: c.read.retries,
+		},
+		ks:     c.ks,
+		budget: budget,
+	}
+	cc.ConnectObserver = gocqlPoolObserver{
+		ks:         c.ks,
+		reconnects: newReconnectTracker(cc.NumConns),
 	}
-	cc.PoolConfig.HostSelectionPolicy = gocql.HostPoolHostPolicy(
-		hostpool.NewEpsilonGreedy(c.hosts, 5*time.Minute, &hostpool.LinearEpsilonValueCalculator{}),
-	)
+	cc.QueryObserver = gocqlPoolObserver{ks: c.ks}
 	c.cc = cc
 	return c, nil
 }
 
+// singleHostKsConfig returns the keyspace's config, modified to make a single connection to only the given host. Host
+// selection is plain round-robin (over the one host) rather than epsilon-greedy.
+func singleHostKsConfig(ks, host string) (ksConfig, error) {
+	c, err := getKsConfig(ks)
+	if err != nil {
+		return ksConfig{}, err
+	}
+
+	c.hosts = []string{host}
+	c.cc.Hosts = c.hosts
+	c.cc.NumConns = 1
+	c.cc.ConnectObserver = gocqlPoolObserver{
+		ks:         c.ks,
+		reconnects: newReconnectTracker(c.cc.NumConns),
+	}
+	c.cc.PoolConfig.HostSelectionPolicy = gocql.RoundRobinHostPolicy()
+	return c, nil
+}
+
 func getHosts() []string {
 	port := config.AtPath("hailo", "service", "cassandra", "defaults", "cqlPort").AsInt(defaultPort)
+
+	// If a DNS role is configured, it takes precedence over a static list of hosts
+	if role := hostsDnsRole(); role != "" {
+		hosts, err := dns.Hosts(role)
+		if err == nil && len(hosts) > 0 {
+			return withPort(hosts, port)
+		}
+		log.Errorf("[Cassandra] Failed to load hosts from DNS role %s (falling back to configured hosts): %v", role, err)
+	}
+
 	hosts := config.AtPath("hailo", "service", "cassandra", hostsCfgKey()).AsHostnameArray(port)
 	if len(hosts) > 0 {
 		return hosts
@@ -150,11 +602,51 @@ func getHosts() []string {
 	if len(hosts) == 0 {
 		return defaultHosts
 	}
-	// We need to append the port to hosts coming from DNS
+
+	return withPort(hosts, port)
+}
+
+// pinHostIPs returns whether hostnames should be resolved to IPs (and the IPs pinned into the cluster config) when the
+// session is built, rather than gocql resolving them when connecting
+func pinHostIPs() bool {
+	return config.AtPath("hailo", "service", "cassandra", "pinHostIPs").AsBool(false)
+}
+
+// pinHosts resolves the hostnames in hosts ("host:port") to their IPs, keeping the port. Hosts which are already IPs,
+// or which can't be resolved, are returned unchanged.
+func pinHosts(hosts []string) []string {
+	pinned := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		host, port, err := net.SplitHostPort(h)
+		if err != nil || net.ParseIP(host) != nil {
+			pinned = append(pinned, h)
+			continue
+		}
+
+		ips, err := dns.Resolve(host)
+		if err != nil || len(ips) == 0 {
+			log.Warnf("[Cassandra] Failed to resolve host %s to pin its IPs (using it unresolved): %v", host, err)
+			pinned = append(pinned, h)
+			continue
+		}
+		for _, ip := range ips {
+			pinned = append(pinned, net.JoinHostPort(ip, port))
+		}
+	}
+	return pinned
+}
+
+// hostsDnsRole returns the DNS role from which Cassandra hosts should be discovered, or "" if hosts are not to be
+// discovered this way
+func hostsDnsRole() string {
+	return config.AtPath("hailo", "service", "cassandra", "hostsDnsRole").AsString("")
+}
+
+// withPort appends the port to hosts (as returned by DNS)
+func withPort(hosts []string, port int) []string {
 	for i, host := range hosts {
 		hosts[i] = host + fmt.Sprintf(":%d", port)
 	}
-
 	return hosts
 }
 
@@ -177,7 +669,7 @@ func hostsCfgKey() string {
 
 // ksAuth returns the username and password for the given keyspace
 func ksAuth(ks string) (string, string, error) {
-	if !config.AtPath("hailo", "service", "cassandra", "authentication", "enabled").AsBool() {
+	if !config.AtPath("hailo", "service", "cassandra", "authentication", "enabled").AsBool(false) {
 		return "", "", nil
 	}
 
@@ -0,0 +1,276 @@
+package gocassa
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/hailocab/go-hostpool"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+	"github.com/hailocab/service-layer/dns"
+	"github.com/hailocab/service-layer/retry"
+)
+
+func TestKsConfigValidate(t *testing.T) {
+	valid := func() ksConfig {
+		cc := gocql.NewCluster("10.0.0.1:9042")
+		cc.NumConns = 2
+		return ksConfig{
+			ks:       "validate_ks",
+			hosts:    []string{"10.0.0.1:9042"},
+			retries:  5,
+			cl:       gocql.LocalQuorum,
+			read:     readPolicy{cl: gocql.One},
+			writeCl:  gocql.Quorum,
+			serialCl: gocql.Serial,
+			timeout:  time.Second,
+			cc:       cc,
+		}
+	}
+	assert.NoError(t, valid().validate())
+
+	c := valid()
+	c.hosts = nil
+	assert.EqualError(t, c.validate(), "Invalid config for keyspace validate_ks: no hosts")
+
+	c = valid()
+	c.timeout = 0
+	assert.EqualError(t, c.validate(), "Invalid config for keyspace validate_ks: recvTimeout must be positive (got 0s)")
+
+	c = valid()
+	c.cc.NumConns = 0
+	assert.EqualError(t, c.validate(), "Invalid config for keyspace validate_ks: maxHostConns must be positive (got 0)")
+
+	c = valid()
+	c.clientTimestamps = true
+	c.cc.ProtoVersion = 2
+	assert.EqualError(t, c.validate(),
+		"Invalid config for keyspace validate_ks: clientTimestamps requires protoVersion 3 or later (got 2)")
+	c.cc.ProtoVersion = 3
+	assert.NoError(t, c.validate())
+
+	c = valid()
+	c.pingCl = gocql.LocalOne + 1
+	assert.EqualError(t, c.validate(), "Invalid config for keyspace validate_ks: unknown healthCheckConsistencyLevel 11")
+
+	c = valid()
+	c.slow = -time.Second
+	assert.EqualError(t, c.validate(),
+		"Invalid config for keyspace validate_ks: slowQueryThreshold must not be negative (got -1s)")
+
+	c = valid()
+	c.tls = tlsOptions{enabled: true, certPath: "/etc/ssl/client.pem"}
+	assert.EqualError(t, c.validate(),
+		"Invalid config for keyspace validate_ks: tls certPath and keyPath must be set together")
+	c.tls.keyPath = "/etc/ssl/client.key"
+	assert.NoError(t, c.validate())
+
+	c = valid()
+	c.localDc = "eu-west-1"
+	c.dcs = map[string]string{"10.0.0.1": "us-east-1", "10.0.0.2": "eu-west-1"}
+	assert.EqualError(t, c.validate(),
+		"Invalid config for keyspace validate_ks: no hosts are mapped to localDatacentre eu-west-1",
+		"A mapping for a host which isn't configured doesn't count")
+	c.hosts = append(c.hosts, "10.0.0.2:9042")
+	assert.NoError(t, c.validate())
+
+	c = valid()
+	c.read.retries = -1
+	assert.EqualError(t, c.validate(),
+		"Invalid config for keyspace validate_ks: read maxRetries must not be negative (got -1)")
+
+	c = valid()
+	c.serialCl = 0
+	assert.EqualError(t, c.validate(), "Invalid config for keyspace validate_ks: unknown serialConsistencyLevel 0")
+
+	c = valid()
+	c.read.serialCl = serialClFromString("serail")
+	assert.EqualError(t, c.validate(),
+		"Invalid config for keyspace validate_ks: unknown read serialConsistencyLevel 65535")
+	c.read.serialCl = serialClFromString("local_serial")
+	assert.NoError(t, c.validate())
+
+	c = valid()
+	c.maxBatch = -1
+	assert.EqualError(t, c.validate(),
+		"Invalid config for keyspace validate_ks: maxBatchStatements must not be negative (got -1)")
+}
+
+func TestHostPoolDecayFromConfig(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"hosts": ["10.0.0.1"],
+		"defaults": {"hostPoolDecay": "30s"}
+	}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	var decay time.Duration
+	defer func(orig func([]string, time.Duration, hostpool.EpsilonValueCalculator) hostpool.HostPool) {
+		newEpsilonGreedy = orig
+	}(newEpsilonGreedy)
+	newEpsilonGreedy = func(hosts []string, d time.Duration, calc hostpool.EpsilonValueCalculator) hostpool.HostPool {
+		decay = d
+		return hostpool.NewEpsilonGreedy(hosts, d, calc)
+	}
+
+	c, err := getKsConfig("decay_ks")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, c.decay)
+	assert.Equal(t, time.Duration(0), decay, "The host pool should not be built until the config is applied")
+
+	c = c.withHostPool()
+	defer c.closeHostPool()
+	assert.Equal(t, 30*time.Second, decay, "Configured decay should be passed to the host pool")
+}
+
+// closeCountingPool is a HostPool which counts how many times it is closed
+type closeCountingPool struct {
+	hostpool.HostPool
+	closed *int
+}
+
+func (p closeCountingPool) Close() {
+	*p.closed++
+	p.HostPool.Close()
+}
+
+func TestHostPoolBuiltOnlyWhenApplied(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"hosts": ["10.0.0.1"]}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	built, closed := 0, 0
+	defer func(orig func([]string, time.Duration, hostpool.EpsilonValueCalculator) hostpool.HostPool) {
+		newEpsilonGreedy = orig
+	}(newEpsilonGreedy)
+	newEpsilonGreedy = func(hosts []string, d time.Duration, calc hostpool.EpsilonValueCalculator) hostpool.HostPool {
+		built++
+		return closeCountingPool{hostpool.NewEpsilonGreedy(hosts, d, calc), &closed}
+	}
+
+	// Reading config (as reloads which find it unchanged, and ValidateConfig, do) mustn't build a pool
+	c, err := getKsConfig("pool_ks")
+	assert.NoError(t, err)
+	assert.Nil(t, c.pool)
+	assert.Nil(t, c.cc.PoolConfig.HostSelectionPolicy)
+	single, err := singleHostKsConfig("pool_ks", "10.0.0.1:9042")
+	assert.NoError(t, err)
+	assert.Nil(t, single.pool)
+	single.closeHostPool()
+	assert.Equal(t, 0, built)
+
+	c = c.withHostPool()
+	assert.Equal(t, 1, built)
+	assert.NotNil(t, c.hostPool)
+	assert.NotNil(t, c.cc.PoolConfig.HostSelectionPolicy)
+	c.closeHostPool()
+	assert.Equal(t, 1, closed)
+}
+
+func TestLimiterResizedOnlyWhenApplied(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"hosts": ["10.0.0.1"],
+		"defaults": {"maxConcurrentQueries": 2}
+	}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	applied := concurrencyLimiterFor("limit_ks", 1, false)
+
+	// Reading config mustn't replace the limiter queries are using
+	c, err := getKsConfig("limit_ks")
+	assert.NoError(t, err)
+	assert.Nil(t, c.limiter)
+	limitersMtx.Lock()
+	assert.True(t, limiters["limit_ks"] == applied)
+	limitersMtx.Unlock()
+
+	c = c.withLimiter()
+	assert.Equal(t, 2, c.limiter.limit)
+	limitersMtx.Lock()
+	assert.True(t, limiters["limit_ks"] == c.limiter)
+	limitersMtx.Unlock()
+}
+
+func TestTLSFromConfig(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"hosts": ["10.0.0.1"]}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	plain, err := getKsConfig("tls_ks")
+	assert.NoError(t, err)
+	assert.Nil(t, plain.cc.SslOpts)
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"hosts": ["10.0.0.1"],
+		"tls": {"enabled": true, "caPath": "/etc/ssl/ca.pem", "serverName": "cassandra.internal"}
+	}}}}`))
+	c, err := getKsConfig("tls_ks")
+	assert.NoError(t, err)
+	assert.NotNil(t, c.cc.SslOpts)
+	assert.Equal(t, "/etc/ssl/ca.pem", c.cc.SslOpts.CaPath)
+	assert.Equal(t, "cassandra.internal", c.cc.SslOpts.ServerName)
+	assert.True(t, c.cc.SslOpts.EnableHostVerification)
+	assert.NotEqual(t, plain.hash(), c.hash(), "Enabling TLS should cause the session to be rebuilt")
+}
+
+func TestPinHosts(t *testing.T) {
+	mr := &dns.MockResolver{}
+	mr.On("LookupIP", "cassandra-1.example.com").Return([]net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1")}, nil)
+	mr.On("LookupIP", "gone.example.com").Return([]net.IP(nil), fmt.Errorf("no such host"))
+	defer dns.SetDefaultResolver(dns.SetDefaultResolver(mr))
+
+	pinned := pinHosts([]string{"cassandra-1.example.com:9042", "10.0.0.9:9042", "gone.example.com:9042"})
+	assert.Equal(t, []string{"10.0.0.1:9042", "10.0.0.2:9042", "10.0.0.9:9042", "gone.example.com:9042"}, pinned)
+}
+
+func TestLoggableRedaction(t *testing.T) {
+	stmt := "SELECT ssn, name FROM people WHERE email = 'a@b.com'"
+	c := ksConfig{}
+	assert.Equal(t, stmt, c.loggable(stmt), "Statements should be logged as-is unless redaction is enabled")
+
+	c.redact = true
+	assert.Equal(t, "SELECT ssn, name FROM people WHERE email = ?", c.loggable(stmt))
+
+	c.redactPattern = columnsPattern([]string{"SSN", "email"})
+	assert.Equal(t, "SELECT <redacted>, name FROM people WHERE <redacted> = ?", c.loggable(stmt))
+}
+
+func TestSerialConsistencyConfig(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{}`))
+	assert.Equal(t, gocql.Serial, serialConsistencyConfig("serial_ks"))
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"defaults": {"serialConsistencyLevel": "local_serial"},
+		"serialConsistency": {"global_ks": "serial"}
+	}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	assert.Equal(t, gocql.LocalSerial, serialConsistencyConfig("serial_ks"))
+	assert.Equal(t, gocql.Serial, serialConsistencyConfig("global_ks"), "Keyspace's own setting should take precedence")
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"serialConsistency": {"typo_ks": "local_seiral"}
+	}}}}`))
+	assert.Equal(t, invalidSerialCl, serialConsistencyConfig("typo_ks"), "Unknown levels shouldn't fall back")
+}
+
+func TestAwaitConfig(t *testing.T) {
+	origConfig, origPolicy, origTimeout := config.DefaultInstance, initConfigRetryPolicy, configLoadTimeout
+	defer func() {
+		config.DefaultInstance, initConfigRetryPolicy, configLoadTimeout = origConfig, origPolicy, origTimeout
+	}()
+	config.DefaultInstance = config.New()
+	initConfigRetryPolicy = retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	configLoadTimeout = 20 * time.Millisecond
+
+	start := time.Now()
+	assert.Equal(t, errConfigNotLoaded, awaitConfig())
+	assert.True(t, time.Since(start) >= 3*configLoadTimeout, "Each attempt should wait for config")
+
+	// Config loads after the first attempt has timed out
+	config.DefaultInstance = config.New()
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		config.Load(bytes.NewBufferString(`{}`))
+	}()
+	assert.NoError(t, awaitConfig())
+}
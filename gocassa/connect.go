@@ -0,0 +1,105 @@
+package gocassa
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+// Number of connections which may be dialled at once, across all keyspaces, if not configured
+const defaultMaxConcurrentConnects = 4
+
+var (
+	connectSlots    chan struct{}
+	connectSlotsMtx sync.Mutex
+
+	// How long a connection waits for a slot before the dial fails
+	connectSlotTimeout = 5 * time.Second
+
+	errConnectSlotTimeout = errors.New("Timed out waiting to connect to Cassandra")
+)
+
+// maxConcurrentConnects returns how many connections may be dialled at once
+// (hailo/service/cassandra/maxConcurrentConnects). Zero or less removes the limit.
+func maxConcurrentConnects() int {
+	return config.AtPath("hailo", "service", "cassandra", "maxConcurrentConnects").AsInt(defaultMaxConcurrentConnects)
+}
+
+// acquireConnectSlot blocks until ks may dial a connection, returning a func which must be called once it's done. It
+// gives up after connectSlotTimeout, or when ctx is done if that is sooner.
+//
+// gocql opens a session's first connections as it's created, then fills the rest of each host's pool and replaces
+// dead connections in the background, so when many sessions connect at once (eg. on startup, or when a config change
+// reloads every keyspace) the dials are funnelled through a fixed number of slots. This keeps a connect storm from
+// exhausting our file descriptors or swamping the cluster. If the limit is changed, dials already holding a slot keep
+// it until they are done.
+func acquireConnectSlot(ctx context.Context, ks string) (func(), error) {
+	size := maxConcurrentConnects()
+	if size <= 0 {
+		return func() {}, nil
+	}
+
+	connectSlotsMtx.Lock()
+	if cap(connectSlots) != size {
+		connectSlots = make(chan struct{}, size)
+	}
+	slots := connectSlots
+	connectSlotsMtx.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		instCounter(ks, "connect.queued")
+		timer := time.NewTimer(connectSlotTimeout)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+		case <-timer.C:
+			instCounter(ks, "connect.rejected")
+			return nil, errConnectSlotTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() {
+		<-slots
+	}, nil
+}
+
+// cappedDialer is a gocql.Dialer which holds a connect slot while dialling, so every connection a session opens
+// (including those gocql opens in the background) counts against the limit
+type cappedDialer struct {
+	ks     string
+	dialer gocql.Dialer
+}
+
+func (d cappedDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	release, err := acquireConnectSlot(ctx, d.ks)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return d.dialer.DialContext(ctx, network, addr)
+}
+
+// capDials makes cc's connections dial through a cappedDialer, wrapping any dialer already configured (or one with
+// gocql's default settings if there is none)
+func capDials(ks string, cc *gocql.ClusterConfig) {
+	if _, ok := cc.Dialer.(cappedDialer); ok {
+		return
+	}
+	dialer := cc.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{
+			Timeout:   cc.ConnectTimeout,
+			KeepAlive: cc.SocketKeepalive,
+		}
+	}
+	cc.Dialer = cappedDialer{ks: ks, dialer: dialer}
+}
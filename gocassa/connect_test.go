@@ -0,0 +1,122 @@
+package gocassa
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+func TestAcquireConnectSlot(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"maxConcurrentConnects": 1}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	release, err := acquireConnectSlot(context.Background(), "connect_ks")
+	assert.NoError(t, err)
+	acquired := make(chan func())
+	go func() {
+		release2, err := acquireConnectSlot(context.Background(), "connect_ks")
+		assert.NoError(t, err)
+		acquired <- release2
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Second connect should wait for the slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case release2 := <-acquired:
+		release2()
+	case <-time.After(time.Second):
+		t.Fatal("Second connect should proceed once the slot is released")
+	}
+}
+
+func TestAcquireConnectSlotTimeout(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"maxConcurrentConnects": 1}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	defer func(timeout time.Duration) { connectSlotTimeout = timeout }(connectSlotTimeout)
+	connectSlotTimeout = 10 * time.Millisecond
+
+	release, err := acquireConnectSlot(context.Background(), "connect_ks")
+	assert.NoError(t, err)
+	defer release()
+
+	_, err = acquireConnectSlot(context.Background(), "connect_ks")
+	assert.Equal(t, errConnectSlotTimeout, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = acquireConnectSlot(ctx, "connect_ks")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestAcquireConnectSlotUnlimited(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"maxConcurrentConnects": 0}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	for i := 0; i < 10; i++ {
+		_, err := acquireConnectSlot(context.Background(), "connect_ks")
+		assert.NoError(t, err)
+	}
+}
+
+// blockingDialer is a gocql.Dialer whose dials don't complete until released
+type blockingDialer struct {
+	dialling chan struct{}
+	release  chan struct{}
+}
+
+func (d blockingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.dialling <- struct{}{}
+	<-d.release
+	c1, c2 := net.Pipe()
+	c2.Close()
+	return c1, nil
+}
+
+func TestCappedDialer(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"maxConcurrentConnects": 1}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	d := blockingDialer{
+		dialling: make(chan struct{}, 2),
+		release:  make(chan struct{}),
+	}
+	cc := gocql.NewCluster("127.0.0.1")
+	cc.Dialer = d
+	capDials("connect_ks", cc)
+	capDials("connect_ks", cc)
+	assert.Equal(t, cappedDialer{ks: "connect_ks", dialer: d}, cc.Dialer, "Dials should only be capped once")
+
+	done := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			conn, err := cc.Dialer.DialContext(context.Background(), "tcp", "127.0.0.1:9042")
+			assert.NoError(t, err)
+			conn.Close()
+			done <- struct{}{}
+		}()
+	}
+
+	<-d.dialling
+	select {
+	case <-d.dialling:
+		t.Fatal("Second dial should wait for the first to release its slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	d.release <- struct{}{}
+	<-d.dialling
+	d.release <- struct{}{}
+	<-done
+	<-done
+}
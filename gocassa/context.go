@@ -0,0 +1,31 @@
+package gocassa
+
+import (
+	"context"
+	"fmt"
+)
+
+type requestIdKey struct{}
+
+// WithRequestId returns a copy of ctx carrying the id of the request on whose behalf statements are run. Statements run
+// with the returned context (eg. via QueryContext) include the id in their log lines, so that a single request's
+// Cassandra activity can be followed through the logs. The id is only logged: metrics aren't tagged with it, as a
+// metric per request would swamp the metrics backend.
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestId returns the request id carried by ctx (see WithRequestId), or blank if there is none
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// logPrefix returns the prefix for log lines about ks, including the request id carried by ctx if there is one (eg.
+// "[Cassandra:ks requestId=abc]")
+func logPrefix(ctx context.Context, ks string) string {
+	if id := RequestId(ctx); id != "" {
+		return fmt.Sprintf("[Cassandra:%s requestId=%s]", ks, id)
+	}
+	return fmt.Sprintf("[Cassandra:%s]", ks)
+}
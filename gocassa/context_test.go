@@ -0,0 +1,18 @@
+package gocassa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogPrefix(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", RequestId(ctx))
+	assert.Equal(t, "[Cassandra:prefix_ks]", logPrefix(ctx, "prefix_ks"))
+
+	ctx = WithRequestId(ctx, "a1b2c3")
+	assert.Equal(t, "a1b2c3", RequestId(ctx))
+	assert.Equal(t, "[Cassandra:prefix_ks requestId=a1b2c3]", logPrefix(ctx, "prefix_ks"))
+}
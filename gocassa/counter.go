@@ -0,0 +1,53 @@
+package gocassa
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Matches an UPDATE whose (first) assignment adds to or subtracts from the column itself, capturing the column,
+	// the column it's added to, and the operand. Tables with counter columns may contain only counters (besides their
+	// primary key), so the first assignment is enough to tell a counter update.
+	counterUpdatePattern = regexp.MustCompile(
+		`(?is)^\s*UPDATE\s.*?\bSET\s+("?\w+"?)\s*=\s*("?\w+"?)\s*[-+]\s*(\?|\d+\b)`)
+	counterTablePattern  = regexp.MustCompile(`^\w+(?:\.\w+)?$`)
+	counterColumnPattern = regexp.MustCompile(`^\w+$`)
+)
+
+// counterIncrementStmt returns a statement adding a bound delta to the counter column of the rows matched by where
+func counterIncrementStmt(table, column, where string) (string, error) {
+	switch {
+	case !counterTablePattern.MatchString(table):
+		return "", fmt.Errorf("Invalid counter table name %q", table)
+	case !counterColumnPattern.MatchString(column):
+		return "", fmt.Errorf("Invalid counter column name %q", column)
+	case strings.TrimSpace(where) == "":
+		return "", fmt.Errorf("Counter update of %s.%s must have a WHERE clause", table, column)
+	}
+	return fmt.Sprintf("UPDATE %s SET %s = %s + ? WHERE %s", table, column, column, where), nil
+}
+
+// isCounterUpdate returns whether stmt (bound to params) updates a counter: that is, whether it adds a number to a
+// column (eg. "UPDATE hits SET n = n + ? WHERE ..."). Collections are updated the same way ("SET l = l + ?"), so
+// where the operand is a bind marker it's only taken to be a counter update if the value bound is an integer.
+func isCounterUpdate(stmt string, params []interface{}) bool {
+	m := counterUpdatePattern.FindStringSubmatchIndex(stmt)
+	if m == nil || !strings.EqualFold(stmt[m[2]:m[3]], stmt[m[4]:m[5]]) {
+		return false
+	}
+	if stmt[m[6]:m[7]] != "?" {
+		return true
+	}
+
+	i := strings.Count(stmt[:m[6]], "?") // The operand's position among the bind markers
+	if i >= len(params) {
+		return true
+	}
+	switch params[i].(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
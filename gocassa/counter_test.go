@@ -0,0 +1,39 @@
+package gocassa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterIncrementStmt(t *testing.T) {
+	stmt, err := counterIncrementStmt("page_views", "views", "page = ?")
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE page_views SET views = views + ? WHERE page = ?", stmt)
+	assert.True(t, isCounterUpdate(stmt, []interface{}{int64(1), "/home"}))
+
+	_, err = counterIncrementStmt("stats.page_views", "views", "page = ?")
+	assert.NoError(t, err)
+
+	_, err = counterIncrementStmt("page_views; DROP TABLE users", "views", "page = ?")
+	assert.EqualError(t, err, `Invalid counter table name "page_views; DROP TABLE users"`)
+	_, err = counterIncrementStmt("page_views", "views + 1", "page = ?")
+	assert.EqualError(t, err, `Invalid counter column name "views + 1"`)
+	_, err = counterIncrementStmt("page_views", "views", " ")
+	assert.EqualError(t, err, "Counter update of page_views.views must have a WHERE clause")
+}
+
+func TestIsCounterUpdate(t *testing.T) {
+	assert.True(t, isCounterUpdate("UPDATE hits SET n = n + 1 WHERE id = ?", []interface{}{"a"}))
+	assert.True(t, isCounterUpdate("update hits set N = n - ? where id = ?", []interface{}{5, "a"}))
+	assert.True(t, isCounterUpdate("UPDATE hits USING TIMESTAMP ? SET n = n + ? WHERE id = ?",
+		[]interface{}{int64(1), int64(2), "a"}), "Markers before the operand should be skipped")
+	assert.True(t, isCounterUpdate("UPDATE hits SET n = n + ? WHERE id = ?", nil))
+
+	assert.False(t, isCounterUpdate("UPDATE users SET name = ? WHERE id = ?", []interface{}{"bob", "a"}))
+	assert.False(t, isCounterUpdate("UPDATE users SET tags = tags + ? WHERE id = ?",
+		[]interface{}{[]string{"x"}, "a"}), "Collection appends aren't counter updates")
+	assert.False(t, isCounterUpdate("UPDATE users SET tags = tags + ['x'] WHERE id = ?", []interface{}{"a"}))
+	assert.False(t, isCounterUpdate("UPDATE users SET n = m + 1 WHERE id = ?", []interface{}{"a"}))
+	assert.False(t, isCounterUpdate("INSERT INTO hits (id, n) VALUES (?, ?)", []interface{}{"a", 1}))
+}
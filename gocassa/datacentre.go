@@ -0,0 +1,109 @@
+package gocassa
+
+import (
+	"net"
+	"sync"
+
+	"github.com/hailocab/go-hostpool"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+// datacentreConfig returns the datacentre whose hosts are preferred (hailo/service/cassandra/localDatacentre; "" if
+// hosts aren't selected by datacentre), and the datacentre of each host (hailo/service/cassandra/datacentres, mapping
+// each host's address to its datacentre)
+func datacentreConfig() (string, map[string]string) {
+	localDc := config.AtPath("hailo", "service", "cassandra", "localDatacentre").AsString("")
+	dcs := config.AtPath("hailo", "service", "cassandra", "datacentres").AsStringMap()
+	return localDc, dcs
+}
+
+// hasDcHosts returns whether any of the configured hosts is in the local datacentre
+func (c ksConfig) hasDcHosts() bool {
+	for _, h := range c.hosts {
+		if isLocal(h, c.localDc, c.dcs) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocal returns whether host (an address, optionally with a port) is mapped to localDc by dcs
+func isLocal(host, localDc string, dcs map[string]string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return dcs[host] == localDc
+}
+
+// dcHostPool is a HostPool which only selects hosts in the local datacentre while any of them are available, falling
+// back to hosts in other datacentres (or whose datacentre isn't known) when none are. Hosts are selected round-robin
+// within each group, rather than epsilon-greedily: latency to remote hosts would otherwise skew the scores.
+//
+// gocql removes hosts from the pool when it finds them to be down, so the local datacentre is only abandoned once
+// gocql has marked all of its hosts down.
+type dcHostPool struct {
+	hostpool.HostPool // Local hosts
+	remote            hostpool.HostPool
+	ks                string
+	localDc           string
+	dcs               map[string]string // Host address to datacentre
+
+	mtx        sync.RWMutex
+	localHosts int
+}
+
+func newDcHostPool(ks, localDc string, dcs map[string]string, hosts []string) *dcHostPool {
+	p := &dcHostPool{
+		HostPool: hostpool.New(nil),
+		remote:   hostpool.New(nil),
+		ks:       ks,
+		localDc:  localDc,
+		dcs:      dcs,
+	}
+	p.SetHosts(hosts)
+	return p
+}
+
+func (p *dcHostPool) SetHosts(hosts []string) {
+	var local, remote []string
+	for _, h := range hosts {
+		if isLocal(h, p.localDc, p.dcs) {
+			local = append(local, h)
+		} else {
+			remote = append(remote, h)
+		}
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.HostPool.SetHosts(local)
+	p.remote.SetHosts(remote)
+	p.localHosts = len(local)
+}
+
+func (p *dcHostPool) Get() hostpool.HostPoolResponse {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	if p.localHosts > 0 {
+		return p.HostPool.Get()
+	}
+	instCounter(p.ks, "datacentre.fallback")
+	return p.remote.Get()
+}
+
+func (p *dcHostPool) Hosts() []string {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return append(p.HostPool.Hosts(), p.remote.Hosts()...)
+}
+
+func (p *dcHostPool) ResetAll() {
+	p.HostPool.ResetAll()
+	p.remote.ResetAll()
+}
+
+func (p *dcHostPool) Close() {
+	p.HostPool.Close()
+	p.remote.Close()
+}
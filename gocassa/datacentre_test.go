@@ -0,0 +1,36 @@
+package gocassa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	inst "github.com/hailocab/service-layer/instrumentation"
+)
+
+func TestDcHostPool(t *testing.T) {
+	inst.SaveCounter("cassandra.dc_ks.datacentre.fallback")
+	dcs := map[string]string{
+		"10.0.0.1": "eu-west-1",
+		"10.0.0.2": "eu-west-1",
+		"10.1.0.1": "us-east-1",
+	}
+	p := newDcHostPool("dc_ks", "eu-west-1", dcs, []string{"10.0.0.1:9042", "10.0.0.2:9042", "10.1.0.1:9042"})
+	assert.Len(t, p.Hosts(), 3)
+
+	for i := 0; i < 10; i++ {
+		r := p.Get()
+		assert.NotEqual(t, "10.1.0.1:9042", r.Host(), "Remote host shouldn't be used whilst local hosts are available")
+		r.Mark(nil)
+	}
+	assert.Equal(t, int64(0), inst.GetCounter("cassandra.dc_ks.datacentre.fallback").Count())
+
+	// gocql removes hosts which are down; once no local hosts remain, remote ones are used
+	p.SetHosts([]string{"10.1.0.1:9042", "10.2.0.1:9042"})
+	r := p.Get()
+	assert.Contains(t, []string{"10.1.0.1:9042", "10.2.0.1:9042"}, r.Host())
+	assert.Equal(t, int64(1), inst.GetCounter("cassandra.dc_ks.datacentre.fallback").Count())
+
+	p.SetHosts([]string{"10.0.0.2", "10.1.0.1"})
+	assert.Equal(t, "10.0.0.2", p.Get().Host(), "Addresses without a port should also be matched")
+}
@@ -0,0 +1,38 @@
+package gocassa
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+// Number of consecutive Unavailable reads after which reads are downgraded, if not configured
+const defaultDowngradeAfter = 3
+
+// downgradeConfig returns the keyspace's consistency downgrade policy
+// (hailo/service/cassandra/consistencyDowngrade/<ks>). It's disabled unless explicitly enabled for the keyspace, since
+// reads which are downgraded may return stale data.
+func downgradeConfig(ks string) (enabled bool, cl gocql.Consistency, after int) {
+	path := []string{"hailo", "service", "cassandra", "consistencyDowngrade", ks}
+	enabled = config.AtPath(append(path, "enabled")...).AsBool(false)
+	cl = clOrDefault(config.AtPath(append(path, "consistencyLevel")...).AsString(""), gocql.LocalOne)
+	after = config.AtPath(append(path, "afterUnavailable")...).AsInt(defaultDowngradeAfter)
+	return enabled, cl, after
+}
+
+// shouldDowngrade records the outcome of a read at the keyspace's normal consistency, returning whether it should be
+// retried at the downgraded consistency: that is, if downgrading is enabled and this was the latest of at least
+// downgradeAfter consecutive reads to fail because not enough replicas were available.
+func (e *gocqlExecutor) shouldDowngrade(cfg ksConfig, err error) bool {
+	if !cfg.downgrade {
+		return false
+	}
+	if !errors.Is(err, ErrUnavailable) {
+		atomic.StoreInt64(&e.unavailableStreak, 0)
+		return false
+	}
+	return atomic.AddInt64(&e.unavailableStreak, 1) >= int64(cfg.downgradeAfter)
+}
@@ -0,0 +1,64 @@
+package gocassa
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+func TestShouldDowngrade(t *testing.T) {
+	e := &gocqlExecutor{ks: "downgrade_ks"}
+	unavailable := &Error{Kind: ErrUnavailable, Err: errors.New("Cannot achieve consistency level QUORUM")}
+
+	cfg := ksConfig{ks: "downgrade_ks"}
+	for i := 0; i < 5; i++ {
+		assert.False(t, e.shouldDowngrade(cfg, unavailable), "Downgrading should be opt-in")
+	}
+
+	cfg.downgrade, cfg.downgradeCl, cfg.downgradeAfter = true, gocql.LocalOne, 3
+	e.unavailableStreak = 0
+	assert.False(t, e.shouldDowngrade(cfg, unavailable))
+	assert.False(t, e.shouldDowngrade(cfg, unavailable))
+	assert.True(t, e.shouldDowngrade(cfg, unavailable))
+	assert.True(t, e.shouldDowngrade(cfg, unavailable))
+
+	// Any other outcome resets the streak
+	assert.False(t, e.shouldDowngrade(cfg, nil))
+	assert.False(t, e.shouldDowngrade(cfg, unavailable))
+	assert.False(t, e.shouldDowngrade(cfg, &Error{Kind: ErrTimeout, Err: errors.New("Read timeout")}))
+	assert.False(t, e.shouldDowngrade(cfg, unavailable))
+}
+
+func TestDowngradeConfig(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"consistencyDowngrade": {
+		"downgrade_ks": {"enabled": true, "consistencyLevel": "one", "afterUnavailable": 5}
+	}}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	enabled, cl, after := downgradeConfig("downgrade_ks")
+	assert.True(t, enabled)
+	assert.Equal(t, gocql.One, cl)
+	assert.Equal(t, 5, after)
+
+	enabled, cl, after = downgradeConfig("other_ks")
+	assert.False(t, enabled, "Downgrading should be enabled per keyspace")
+	assert.Equal(t, gocql.LocalOne, cl)
+	assert.Equal(t, defaultDowngradeAfter, after)
+}
+
+func TestSwapSessionResetsUnavailableStreak(t *testing.T) {
+	e := &gocqlExecutor{ks: "downgrade_ks"}
+	unavailable := &Error{Kind: ErrUnavailable, Err: errors.New("Cannot achieve consistency level QUORUM")}
+	cfg := ksConfig{ks: "downgrade_ks", downgrade: true, downgradeCl: gocql.LocalOne, downgradeAfter: 2,
+		cc: gocql.NewCluster("10.0.0.1")}
+	e.shouldDowngrade(cfg, unavailable)
+
+	e.swapSession(&sessionRef{close: func() {}}, cfg)
+	assert.False(t, e.shouldDowngrade(cfg, unavailable), "A reload should reset the streak")
+	assert.True(t, e.shouldDowngrade(cfg, unavailable))
+}
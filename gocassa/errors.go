@@ -0,0 +1,115 @@
+package gocassa
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	// ErrConnCheckoutTimeout is returned when no connection could be checked out of the pool to run a statement (eg.
+	// all hosts are down or backing off)
+	ErrConnCheckoutTimeout = errors.New("Timed out checking out a Cassandra connection")
+	// ErrResultTooLarge is returned (along with the rows read so far) when a query matches more rows than the
+	// configured maxRows cap
+	ErrResultTooLarge = errors.New("Cassandra result set exceeds the maximum number of rows")
+	// ErrTooManyConcurrentQueries is returned when a keyspace's limit on concurrent queries (maxConcurrentQueries) has
+	// been reached, and no slot became free in time
+	ErrTooManyConcurrentQueries = errors.New("Too many concurrent Cassandra queries")
+	// ErrBatchTooLarge is returned (wrapped, so test for it with errors.Is) by ExecuteAtomically when a batch has more
+	// statements than the keyspace's maxBatchStatements cap, without the batch being attempted
+	ErrBatchTooLarge = errors.New("Cassandra batch has too many statements")
+	// ErrMixedCounterBatch is returned (wrapped, so test for it with errors.Is) by ExecuteAtomically when a batch mixes
+	// counter updates with other mutations, which Cassandra doesn't allow
+	ErrMixedCounterBatch = errors.New("Cassandra batch mixes counter updates with other mutations")
+	// ErrPartialResult is returned (wrapped in a *PartialResultError, so test for it with errors.Is) along with the
+	// rows read so far when a query fails part way through its results
+	ErrPartialResult = errors.New("Cassandra query failed after returning some rows")
+
+	// The following classify errors returned by Cassandra; returned errors are wrapped in an *Error so test for these
+	// with errors.Is
+	ErrTimeout     = errors.New("Cassandra request timed out")
+	ErrUnavailable = errors.New("Not enough Cassandra replicas available")
+	ErrSyntax      = errors.New("Invalid CQL statement")
+)
+
+// Error wraps an error returned by gocql, classifying it as one of ErrTimeout, ErrUnavailable or ErrSyntax. The
+// original error remains available via errors.As/errors.Unwrap.
+type Error struct {
+	Kind error // The classification (eg. ErrTimeout)
+	Err  error // The underlying gocql error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying gocql error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is this error's classification
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// PartialResultError is returned by queries which fail after some rows have been read (eg. fetching a later page timed
+// out). The rows read are returned alongside it, but they are incomplete: callers which can make do with partial data
+// may use them, and those which can't should treat this like any other failure. errors.Is matches both
+// ErrPartialResult and the underlying failure's classification (eg. ErrTimeout).
+type PartialResultError struct {
+	Rows int   // The number of rows read before the failure
+	Err  error // The failure
+}
+
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("Cassandra query failed after returning %d rows: %s", e.Rows, e.Err.Error())
+}
+
+// Unwrap returns the failure
+func (e *PartialResultError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrPartialResult
+func (e *PartialResultError) Is(target error) bool {
+	return target == ErrPartialResult
+}
+
+// partialResult wraps err in a *PartialResultError if rows had been read when it occurred
+func partialResult(rows int, err error) error {
+	if err == nil || rows == 0 {
+		return err
+	}
+	return &PartialResultError{Rows: rows, Err: err}
+}
+
+// classifyErr maps low-level gocql errors onto the typed errors exposed by this package, so callers (and our retry
+// and metrics logic) can distinguish them
+func classifyErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch err {
+	case gocql.ErrNoConnections:
+		return ErrConnCheckoutTimeout
+	case gocql.ErrTimeoutNoResponse:
+		return &Error{Kind: ErrTimeout, Err: err}
+	}
+
+	switch e := err.(type) {
+	case *gocql.RequestErrReadTimeout, *gocql.RequestErrWriteTimeout:
+		return &Error{Kind: ErrTimeout, Err: err}
+	case *gocql.RequestErrUnavailable:
+		return &Error{Kind: ErrUnavailable, Err: err}
+	case gocql.RequestError:
+		switch e.Code() {
+		case gocql.ErrCodeSyntax, gocql.ErrCodeInvalid:
+			return &Error{Kind: ErrSyntax, Err: err}
+		}
+	}
+	return err
+}
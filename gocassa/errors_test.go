@@ -0,0 +1,55 @@
+package gocassa
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyErr(t *testing.T) {
+	assert.Nil(t, classifyErr(nil))
+	assert.Equal(t, ErrConnCheckoutTimeout, classifyErr(gocql.ErrNoConnections))
+
+	err := classifyErr(&gocql.RequestErrUnavailable{})
+	assert.True(t, errors.Is(err, ErrUnavailable))
+	assert.False(t, errors.Is(err, ErrTimeout))
+	var unavailable *gocql.RequestErrUnavailable
+	assert.True(t, errors.As(err, &unavailable), "Original error should be unwrappable")
+
+	err = classifyErr(&gocql.RequestErrReadTimeout{})
+	assert.True(t, errors.Is(err, ErrTimeout))
+
+	err = classifyErr(gocql.ErrTimeoutNoResponse)
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.True(t, errors.Is(err, gocql.ErrTimeoutNoResponse))
+
+	plain := errors.New("something else")
+	assert.Equal(t, plain, classifyErr(plain))
+}
+
+func TestCheckoutFailure(t *testing.T) {
+	reason, ok := checkoutFailure(classifyErr(gocql.ErrNoConnections))
+	assert.True(t, ok)
+	assert.Equal(t, CheckoutNoConnections, reason)
+
+	reason, ok = checkoutFailure(classifyErr(gocql.ErrNoStreams))
+	assert.True(t, ok)
+	assert.Equal(t, "noStreams", reason.String())
+
+	_, ok = checkoutFailure(classifyErr(gocql.ErrTimeoutNoResponse))
+	assert.False(t, ok)
+}
+
+func TestPartialResult(t *testing.T) {
+	assert.Nil(t, partialResult(3, nil))
+
+	timeout := classifyErr(gocql.ErrTimeoutNoResponse)
+	assert.Equal(t, timeout, partialResult(0, timeout), "No rows read isn't a partial result")
+
+	err := partialResult(3, timeout)
+	assert.True(t, errors.Is(err, ErrPartialResult))
+	assert.True(t, errors.Is(err, ErrTimeout), "Underlying classification should still match")
+	assert.EqualError(t, err, "Cassandra query failed after returning 3 rows: "+timeout.Error())
+}
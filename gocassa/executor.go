@@ -1,21 +1,36 @@
 package gocassa
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"errors"
-
 	log "github.com/cihub/seelog"
 	"github.com/gocql/gocql"
 	"github.com/hailocab/gocassa"
 
 	"github.com/hailocab/service-layer/config"
+	"github.com/hailocab/service-layer/dns"
+	"github.com/hailocab/service-layer/retry"
+)
+
+const (
+	pingStmt = "SELECT now() FROM system.local"
+	// How long a query will wait for a slot when the keyspace's maxConcurrentQueries are in flight before failing
+	slotWaitTimeout = 500 * time.Millisecond
+	// Bounds of the (jittered, exponential) delay between retries of a failed config reload
+	reloadRetryBaseDelay = time.Second
+	reloadRetryMaxDelay  = 30 * time.Second
+	// How often hosts are re-resolved when they are discovered from a DNS role, or their IPs are pinned
+	hostsDnsRefreshInterval = 30 * time.Second
 )
 
 var (
 	ksConnections    = map[string]gocassa.Connection{}
+	ksExecutors      = map[string]*gocqlExecutor{}
 	ksConnectionsMtx sync.RWMutex
 )
 
@@ -26,7 +41,16 @@ type gocqlExecutor struct {
 	initMtx     sync.RWMutex
 	lastHash    uint32
 	cfg         ksConfig
-	session     *gocql.Session
+	session     *sessionRef
+	singleHost  string // If set, a single connection is made to only this host (see NewSingleHostConnection)
+	// reloadFailures counts consecutive failed reloads; only accessed from the watchConfig goroutine
+	reloadFailures int
+	// reloadCh requests an immediate reload from the watchConfig goroutine (see ReloadNow), which replies on the
+	// channel sent with the outcome
+	reloadCh chan chan error
+	// unavailableStreak counts consecutive reads which failed as not enough replicas were available (see
+	// shouldDowngrade); accessed atomically
+	unavailableStreak int64
 }
 
 func (e *gocqlExecutor) init() error {
@@ -37,10 +61,24 @@ func (e *gocqlExecutor) init() error {
 	}
 
 	e.initMtx.RUnlock()
+
+	// Config may not be available yet (eg. the config service is briefly unavailable whilst we start up), so it's
+	// awaited (with retries) before giving up. This is done without holding initMtx, so that concurrent callers wait
+	// alongside one another rather than in turn.
+	if err := awaitConfig(); err != nil {
+		return err
+	}
+
 	e.initMtx.Lock()
 	defer e.initMtx.Unlock()
 	if !e.initialised { // Guard against race
-		cfg, err := getKsConfig(e.ks)
+		var cfg ksConfig
+		var err error
+		if e.singleHost != "" {
+			cfg, err = singleHostKsConfig(e.ks, e.singleHost)
+		} else {
+			cfg, err = getKsConfig(e.ks)
+		}
 		if err != nil {
 			return err
 		}
@@ -48,45 +86,188 @@ func (e *gocqlExecutor) init() error {
 		if err != nil {
 			return err
 		}
-		go e.watchConfig()
+		if e.singleHost == "" {
+			e.reloadCh = make(chan chan error)
+			go e.watchConfig()
+		}
 		e.initialised = true
 	}
 	return nil
 }
 
+// switchConfig builds a session from newConfig and, only once that has succeeded, swaps it in and retires the old one
+// (see swapSession). If newConfig is invalid or the new session cannot be created the previous (working) session and
+// config are retained.
+//
+// The new session is probed with a query before being swapped in when it replaces an existing one, but only if
+// failFastOnInit is set when there is none (ie. on init); gocql connects lazily, so otherwise an unreachable cluster
+// isn't noticed until the first query.
 func (e *gocqlExecutor) switchConfig(newConfig ksConfig) error {
-	e.Lock()
-	defer e.Unlock()
-	if e.session != nil {
-		e.session.Close()
+	e.RLock()
+	probe := e.session != nil || newConfig.failFastOnInit
+	e.RUnlock()
+
+	if e.singleHost == "" {
+		newConfig = newConfig.withHostPool()
 	}
-	e.cfg = newConfig
-	session, err := e.cfg.cc.CreateSession()
+	session, err := buildSession(newConfig, probe)
 	if err != nil {
+		newConfig.closeHostPool()
 		return err
 	}
 
-	e.session = session
-	e.lastHash = newConfig.hash()
-
+	newConfig = newConfig.withLimiter()
+	e.swapSession(newSessionRef(session, newConfig), newConfig)
 	return nil
 }
 
+// swapSession makes ref (built from cfg) the executor's session, and retires the session it replaces. Operations
+// started from then on use the new session, while those already in flight on the old one finish with it; it's only
+// closed (along with its config's host pool) once they are done, so a reload doesn't fail them.
+func (e *gocqlExecutor) swapSession(ref *sessionRef, cfg ksConfig) {
+	e.Lock()
+	old := e.session
+	e.session = ref
+	e.cfg = cfg
+	e.lastHash = cfg.hash()
+	// The streak was counted against the old config's policy (which may have been disabled since)
+	atomic.StoreInt64(&e.unavailableStreak, 0)
+	e.Unlock()
+
+	if old != nil {
+		old.retire()
+	}
+}
+
+// buildSession validates cfg and creates a session from it. If probe is set, the session is also checked to be able to
+// query the cluster (a session may be created even though, for example, no hosts are reachable).
+func buildSession(cfg ksConfig, probe bool) (*gocql.Session, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	configureCluster(cfg.ks, cfg.cc)
+	capDials(cfg.ks, cfg.cc)
+	session, err := cfg.cc.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	if !probe {
+		return session, nil
+	}
+	if err := session.Query(pingStmt).Exec(); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("New session for keyspace %s failed to query the cluster: %v", cfg.ks, err)
+	}
+
+	return session, nil
+}
+
+// sessionWithConfig returns the executor's current session along with the config it was built from, and a func which
+// must be called once done with the session (which keeps it open until then, should it be replaced). There is always
+// one once the executor is initialised: init opens a session, and switchConfig only ever replaces it with another.
+func (e *gocqlExecutor) sessionWithConfig() (*gocql.Session, ksConfig, func()) {
+	e.RLock()
+	defer e.RUnlock()
+	return e.session.session, e.cfg, e.session.acquire()
+}
+
+// waitDeadline returns when a wait (eg. for a concurrency slot) should give up: after slotWaitTimeout, or at the
+// context's deadline if that is sooner
+func waitDeadline(ctx context.Context) time.Time {
+	timeout := time.Now().Add(slotWaitTimeout)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(timeout) {
+		timeout = deadline
+	}
+	return timeout
+}
+
 func (e *gocqlExecutor) watchConfig() {
 	configCh := config.SubscribeChanges()
 	retryCh := make(chan struct{})
 
+	// If hosts are discovered from a DNS role, watch it so topology changes trigger a reload. The role itself may be
+	// changed by config.
+	var (
+		role      string
+		hostsCh   <-chan []string
+		stopHosts chan struct{}
+	)
+	watchHosts := func() {
+		newRole := hostsDnsRole()
+		if newRole == role {
+			return
+		}
+		if stopHosts != nil {
+			close(stopHosts)
+			stopHosts, hostsCh = nil, nil
+		}
+		role = newRole
+		if role != "" {
+			stopHosts = make(chan struct{})
+			hostsCh = dns.Watch(role, hostsDnsRefreshInterval, stopHosts)
+		}
+	}
+	watchHosts()
+
+	// If host IPs are pinned, periodically re-resolve them so the pool follows DNS changes
+	pinTicker := time.NewTicker(hostsDnsRefreshInterval)
+	defer pinTicker.Stop()
+
 	for {
 		select {
 		case <-configCh:
+			watchHosts()
 			e.reloadSession(retryCh)
 		case <-retryCh:
 			e.reloadSession(retryCh)
+		case done := <-e.reloadCh:
+			watchHosts()
+			done <- e.reloadSession(retryCh)
+		case <-hostsCh:
+			// The hosts are looked up again as part of the reload; the session is only rebuilt if they have changed
+			e.reloadSession(retryCh)
+		case <-pinTicker.C:
+			if pinHostIPs() {
+				e.reloadSession(retryCh)
+			}
 		}
 	}
 }
 
-func (e *gocqlExecutor) reloadSession(retryCh chan struct{}) {
+// reloadRetryPolicy governs retries of a failed reload. Retries are driven by watchConfig (rather than retry.Do) so
+// that a config change arriving in the meantime is applied immediately.
+var reloadRetryPolicy = retry.Policy{
+	BaseDelay: reloadRetryBaseDelay,
+	MaxDelay:  reloadRetryMaxDelay,
+}
+
+// reloadRetryDelay returns how long to wait before retrying a failed reload, given the number of consecutive failures
+// so far. The delay grows exponentially (capped at reloadRetryMaxDelay) and is jittered so that executors sharing a bad
+// config don't all retry in lockstep.
+func reloadRetryDelay(failures int) time.Duration {
+	return reloadRetryPolicy.Backoff(failures)
+}
+
+// ReloadNow re-reads the executor's config and, if it has changed, applies it, returning once that is done. The
+// outcome is the same as for a reload triggered by a config change.
+func (e *gocqlExecutor) ReloadNow() error {
+	if err := e.init(); err != nil {
+		return err
+	}
+	if e.reloadCh == nil {
+		return fmt.Errorf("Keyspace %s does not reload its config", e.ks)
+	}
+
+	done := make(chan error, 1)
+	e.reloadCh <- done
+	return <-done
+}
+
+// reloadSession re-reads the config and switches to it if it has changed, returning an error if the new config
+// couldn't be read or applied (in which case the previous config is retained, and the reload is retried via retryCh if
+// it could not be applied)
+func (e *gocqlExecutor) reloadSession(retryCh chan struct{}) error {
 	e.RLock()
 	ks := e.ks
 	lastHash := e.lastHash
@@ -94,55 +275,200 @@ func (e *gocqlExecutor) reloadSession(retryCh chan struct{}) {
 
 	if cfg, err := getKsConfig(ks); err != nil {
 		log.Errorf("[Cassandra:%s] Error getting new config: %s", ks, err.Error())
+		return err
 	} else if cfg.hash() != lastHash {
 		log.Infof("[Cassandra:%s] Config changed; invalidating connection pool", ks)
 
 		if err := e.switchConfig(cfg); err != nil {
-			log.Errorf("[Cassandra:%s] Error creating session, retrying after 1s delay: %s", ks, err)
-			time.Sleep(time.Second)
-			retryCh <- struct{}{}
+			delay := reloadRetryDelay(e.reloadFailures)
+			e.reloadFailures++
+			log.Criticalf("[Cassandra:%s] Refusing to apply new config (keeping previous session), retrying after "+
+				"%s: %s", ks, delay.String(), err)
+			time.AfterFunc(delay, func() {
+				retryCh <- struct{}{}
+			})
+			return err
 		}
 
+		e.reloadFailures = 0
+		instCounter(ks, "config.reload.applied")
 		log.Infof("[Cassandra:%s] Switched config to: %s", e.ks, cfg.String())
 	} else {
+		instCounter(ks, "config.reload.skipped")
 		log.Debugf("[Cassandra:%s] Config changed but not invalidating connection pool (hash %d unchanged)", e.ks,
 			e.lastHash)
 	}
+	return nil
 }
 
+// Query runs stmt and returns each row as a map of column name to value.
+//
+// The session is bound to the executor's keyspace, but this only applies to unqualified table names: statements may
+// read from (or write to) other keyspaces, such as system, by fully qualifying the table (eg. "SELECT release_version
+// FROM system.local"). The same applies to Execute and ExecuteAtomically.
+//
+// Results may be returned alongside an error, so check which error before using them. If the query fails after some
+// rows have been read (eg. fetching a later page times out) the rows read so far are returned, incomplete, with a
+// *PartialResultError (errors.Is(err, ErrPartialResult)). If it matches more rows than the keyspace's maxRows, the
+// first maxRows are returned with ErrResultTooLarge.
 func (e *gocqlExecutor) Query(stmt string, params ...interface{}) ([]map[string]interface{}, error) {
 	return e.QueryWithOptions(gocassa.Options{}, stmt, params...)
 }
 
 func (e *gocqlExecutor) QueryWithOptions(opts gocassa.Options, stmt string, params ...interface{}) ([]map[string]interface{}, error) {
+	return e.queryContext(context.Background(), opts, false, stmt, params...)
+}
+
+// QueryContext behaves like Query, but is bound by ctx: its deadline limits both how long we wait for a concurrency
+// slot and the execution of the query itself.
+func (e *gocqlExecutor) QueryContext(ctx context.Context, stmt string, params ...interface{}) ([]map[string]interface{}, error) {
+	return e.queryContext(ctx, gocassa.Options{}, false, stmt, params...)
+}
+
+// QueryIdempotent behaves like QueryContext, but marks the query as idempotent so that it is eligible for automatic
+// retry (see ExecuteIdempotent) and, if configured, speculative execution.
+func (e *gocqlExecutor) QueryIdempotent(ctx context.Context, stmt string, params ...interface{}) ([]map[string]interface{}, error) {
+	return e.queryContext(ctx, gocassa.Options{}, true, stmt, params...)
+}
+
+func (e *gocqlExecutor) queryContext(ctx context.Context, opts gocassa.Options, idempotent bool, stmt string,
+	params ...interface{}) ([]map[string]interface{}, error) {
+
 	if err := e.init(); err != nil {
 		return nil, err
 	}
 
 	start := time.Now()
-	e.RLock()
-	session, ks := e.session, e.ks
-	e.RUnlock()
+	session, cfg, done := e.sessionWithConfig()
+	defer done()
+	ks, maxRows := cfg.ks, cfg.maxRows
 
-	if session == nil {
-		return nil, fmt.Errorf("No open session")
+	release, err := cfg.limiter.acquire(ctx, waitDeadline(ctx))
+	if err != nil {
+		instTiming(ks, "query", err, start)
+		return nil, err
 	}
+	defer release()
 
-	q := session.Query(stmt, params...)
+	q := cfg.read.apply(sampleTrace(ctx, session.Query(stmt, params...).WithContext(ctx), session, cfg)).
+		Idempotent(idempotent)
 	if opts.Consistency != nil {
 		q = q.Consistency(*opts.Consistency)
 	}
+	observer := observeStats(ctx, cfg.cc.QueryObserver)
+	if idempotent && cfg.speculative() {
+		q = q.SetSpeculativeExecutionPolicy(&gocql.SimpleSpeculativeExecution{
+			NumAttempts:  cfg.specAttempts,
+			TimeoutDelay: cfg.specDelay,
+		})
+		observer = speculativeObserver{ks: ks, next: observer}
+	}
+	if observer != nil {
+		q = q.Observer(observer)
+	}
 
-	iter := q.Iter()
+	results, tooLarge, err := scanMaps(q.Iter(), maxRows)
+	if opts.Consistency == nil && e.shouldDowngrade(cfg, err) {
+		log.Warnf("%s Read unavailable at %s; retrying at %s, so results may be stale: %s", logPrefix(ctx, ks),
+			cfg.read.consistency().String(), cfg.downgradeCl.String(), cfg.loggable(stmt))
+		instCounter(ks, "consistency.downgraded")
+		results, tooLarge, err = scanMaps(q.Consistency(cfg.downgradeCl).Iter(), maxRows)
+	}
+	if err == nil && tooLarge {
+		log.Warnf("%s Query matched more than %d rows; returning partial results: %s", logPrefix(ctx, ks), maxRows,
+			cfg.loggable(stmt))
+		err = ErrResultTooLarge
+	}
+	instTiming(ks, "query", err, start)
+	instStatementTiming(ks, stmt, err, start)
+	observeCheckoutTimeout(ks, err)
+	observeSlow(ctx, cfg, stmt, time.Since(start))
+	log.Tracef("%s Query took %s: %s", logPrefix(ctx, ks), time.Since(start).String(), cfg.loggable(stmt))
+	return results, err
+}
+
+// scanMaps reads up to maxRows rows from iter (all of them if maxRows is zero), also returning whether there were more
+func scanMaps(iter *gocql.Iter, maxRows int) ([]map[string]interface{}, bool, error) {
 	results := []map[string]interface{}{}
 	result := map[string]interface{}{}
+	tooLarge := false
 	for iter.MapScan(result) {
+		if maxRows > 0 && len(results) >= maxRows {
+			tooLarge = true
+			break
+		}
 		results = append(results, result)
 		result = map[string]interface{}{}
 	}
-	err := iter.Close()
-	log.Tracef("[Cassandra:%s] Query took %s: %s", ks, time.Since(start).String(), stmt)
-	return results, err
+	return results, tooLarge, partialResult(len(results), classifyErr(iter.Close()))
+}
+
+// QueryOrdered behaves like Query, but preserves the column ordering of the SELECT: columns holds the column names in
+// schema order and each row holds its values positionally in that same order.
+func (e *gocqlExecutor) QueryOrdered(stmt string, params ...interface{}) ([]string, [][]interface{}, error) {
+	return e.QueryOrderedContext(context.Background(), stmt, params...)
+}
+
+// QueryOrderedContext behaves like QueryOrdered, but is bound by ctx (see QueryContext)
+func (e *gocqlExecutor) QueryOrderedContext(ctx context.Context, stmt string, params ...interface{}) ([]string,
+	[][]interface{}, error) {
+
+	if err := e.init(); err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	session, cfg, done := e.sessionWithConfig()
+	defer done()
+	ks, maxRows := cfg.ks, cfg.maxRows
+
+	release, err := cfg.limiter.acquire(ctx, waitDeadline(ctx))
+	if err != nil {
+		instTiming(ks, "query", err, start)
+		return nil, nil, err
+	}
+	defer release()
+
+	iter := cfg.read.apply(sampleTrace(ctx, session.Query(stmt, params...).WithContext(ctx), session, cfg)).Iter()
+	cols := iter.Columns()
+	columns := make([]string, len(cols))
+	for i, col := range cols {
+		columns[i] = col.Name
+	}
+
+	rows := [][]interface{}{}
+	tooLarge := false
+	for {
+		rd, err := iter.RowData()
+		if err != nil {
+			iter.Close()
+			return columns, rows, partialResult(len(rows), classifyErr(err))
+		}
+		if !iter.Scan(rd.Values...) {
+			break
+		}
+		if maxRows > 0 && len(rows) >= maxRows {
+			tooLarge = true
+			break
+		}
+		row := make([]interface{}, len(rd.Values))
+		for i, v := range rd.Values {
+			row[i] = reflect.Indirect(reflect.ValueOf(v)).Interface()
+		}
+		rows = append(rows, row)
+	}
+	err = partialResult(len(rows), classifyErr(iter.Close()))
+	if err == nil && tooLarge {
+		log.Warnf("%s Query matched more than %d rows; returning partial results: %s", logPrefix(ctx, ks), maxRows,
+			cfg.loggable(stmt))
+		err = ErrResultTooLarge
+	}
+	instTiming(ks, "query", err, start)
+	instStatementTiming(ks, stmt, err, start)
+	observeCheckoutTimeout(ks, err)
+	observeSlow(ctx, cfg, stmt, time.Since(start))
+	log.Tracef("%s Ordered query took %s: %s", logPrefix(ctx, ks), time.Since(start).String(), cfg.loggable(stmt))
+	return columns, rows, err
 }
 
 func (e *gocqlExecutor) Execute(stmt string, params ...interface{}) error {
@@ -150,31 +476,195 @@ func (e *gocqlExecutor) Execute(stmt string, params ...interface{}) error {
 }
 
 func (e *gocqlExecutor) ExecuteWithOptions(opts gocassa.Options, stmt string, params ...interface{}) error {
+	return e.executeContext(context.Background(), opts, false, 0, stmt, params...)
+}
+
+// ExecuteContext behaves like Execute, but is bound by ctx: its deadline limits both how long we wait for a
+// concurrency slot and the execution of the statement itself.
+func (e *gocqlExecutor) ExecuteContext(ctx context.Context, stmt string, params ...interface{}) error {
+	return e.executeContext(ctx, gocassa.Options{}, false, 0, stmt, params...)
+}
+
+// ExecuteIdempotent behaves like ExecuteContext, but marks the statement as idempotent so that it is eligible for
+// automatic retry. Only statements which may safely be applied more than once (eg. an INSERT or UPDATE setting fixed
+// values, but not a counter increment or a list append) should be executed this way: a retried statement may well
+// have been applied by the original attempt.
+//
+// Statements run by any other means are never automatically retried.
+func (e *gocqlExecutor) ExecuteIdempotent(ctx context.Context, stmt string, params ...interface{}) error {
+	return e.executeContext(ctx, gocassa.Options{}, true, 0, stmt, params...)
+}
+
+// ExecuteWithTimestamp behaves like Execute, but applies the statement's mutations with the given write timestamp (in
+// microseconds since the epoch) rather than one assigned by the coordinator or, with clientTimestamps, the driver.
+// Cassandra resolves conflicting writes by timestamp (the last write wins), so this gives explicit control over
+// ordering. It requires protoVersion 3 or later.
+func (e *gocqlExecutor) ExecuteWithTimestamp(ts int64, stmt string, params ...interface{}) error {
+	return e.executeContext(context.Background(), gocassa.Options{}, false, ts, stmt, params...)
+}
+
+// executeContext executes stmt. If ts is non-zero, it is used as the write timestamp (see ExecuteWithTimestamp).
+func (e *gocqlExecutor) executeContext(ctx context.Context, opts gocassa.Options, idempotent bool, ts int64,
+	stmt string, params ...interface{}) error {
+
 	if err := e.init(); err != nil {
 		return err
 	}
 
 	start := time.Now()
-	e.RLock()
-	session, ks := e.session, e.ks
-	e.RUnlock()
+	session, cfg, done := e.sessionWithConfig()
+	defer done()
+	ks := cfg.ks
+	if ts != 0 && cfg.cc.ProtoVersion < 3 {
+		// Older protocol versions have no way to send a timestamp, and gocql would silently drop it
+		return fmt.Errorf("Write timestamps require protoVersion 3 or later (keyspace %s uses %d)", ks,
+			cfg.cc.ProtoVersion)
+	}
 
-	if session == nil {
-		return fmt.Errorf("No open session")
+	release, err := cfg.limiter.acquire(ctx, waitDeadline(ctx))
+	if err != nil {
+		instTiming(ks, "execute", err, start)
+		return err
 	}
+	defer release()
 
-	q := session.Query(stmt, params...)
+	q := sampleTrace(ctx, session.Query(stmt, params...).WithContext(ctx), session, cfg).Idempotent(idempotent).
+		Consistency(cfg.writeCl).SerialConsistency(cfg.serialCl)
 	if opts.Consistency != nil {
 		q = q.Consistency(*opts.Consistency)
 	}
+	if ts != 0 {
+		q = q.WithTimestamp(ts)
+	}
+
+	err = classifyErr(q.Exec())
+	instTiming(ks, "execute", err, start)
+	instStatementTiming(ks, stmt, err, start)
+	observeCheckoutTimeout(ks, err)
+	observeSlow(ctx, cfg, stmt, time.Since(start))
+	log.Tracef("%s Execute took %s: %s", logPrefix(ctx, ks), time.Since(start).String(), cfg.loggable(stmt))
+	return err
+}
+
+// Ping runs a trivial query through the executor's session, verifying that we can reach the cluster. The query is run
+// at the keyspace's healthCheckConsistencyLevel rather than its read consistency.
+func (e *gocqlExecutor) Ping() error {
+	return e.PingContext(context.Background())
+}
+
+// PingContext behaves like Ping, but is bound by ctx
+func (e *gocqlExecutor) PingContext(ctx context.Context) error {
+	if err := e.init(); err != nil {
+		return err
+	}
+
+	e.RLock()
+	cl := e.cfg.pingCl
+	e.RUnlock()
+	_, err := e.queryContext(ctx, gocassa.Options{Consistency: &cl}, false, pingStmt)
+	return err
+}
+
+// KeyspaceMetadata returns the schema metadata (tables, columns, etc.) for the executor's keyspace, as seen by its
+// session
+func (e *gocqlExecutor) KeyspaceMetadata() (*gocql.KeyspaceMetadata, error) {
+	if err := e.init(); err != nil {
+		return nil, err
+	}
+
+	session, cfg, done := e.sessionWithConfig()
+	defer done()
+	return session.KeyspaceMetadata(cfg.ks)
+}
+
+// IncrementCounter adds delta (which may be negative) to the counter column of the rows of table matched by where,
+// binding params to where's bind markers. Counter updates are not idempotent, so they are never retried.
+func (e *gocqlExecutor) IncrementCounter(table, column string, delta int64, where string, params ...interface{}) error {
+	stmt, err := counterIncrementStmt(table, column, where)
+	if err != nil {
+		return err
+	}
+	return e.Execute(stmt, append([]interface{}{delta}, params...)...)
+}
+
+// ExecuteAtomically executes the statements as a single logged batch: either all of them are applied or none are.
+// stmts and params must be of equal length, with params[i] being the parameters bound to stmts[i].
+//
+// If the statements are counter updates they are executed as a counter batch instead, which isn't logged; counter
+// updates and other mutations can't be mixed in a batch.
+func (e *gocqlExecutor) ExecuteAtomically(stmts []string, params [][]interface{}) error {
+	if len(stmts) != len(params) {
+		return fmt.Errorf("Number of statements (%d) does not match number of parameter sets (%d)", len(stmts),
+			len(params))
+	}
+
+	if err := e.init(); err != nil {
+		return err
+	}
 
-	err := q.Exec()
-	log.Tracef("[Cassandra:%s] Execute took %s: %s", ks, time.Since(start).String(), stmt)
+	ctx := context.Background()
+	start := time.Now()
+	session, cfg, done := e.sessionWithConfig()
+	defer done()
+	ks := cfg.ks
+	if cfg.maxBatch > 0 && len(stmts) > cfg.maxBatch {
+		instCounter(ks, "batch.tooLarge")
+		return fmt.Errorf("%w: %d statements exceeds the limit of %d for keyspace %s; split it into smaller batches",
+			ErrBatchTooLarge, len(stmts), cfg.maxBatch, ks)
+	}
+
+	batchType := gocql.LoggedBatch
+	counters := 0
+	for i, stmt := range stmts {
+		if isCounterUpdate(stmt, params[i]) {
+			counters++
+		}
+	}
+	if counters > 0 {
+		if counters < len(stmts) {
+			return fmt.Errorf("%w: %d of %d statements are counter updates", ErrMixedCounterBatch, counters, len(stmts))
+		}
+		batchType = gocql.CounterBatch
+	}
+
+	release, err := cfg.limiter.acquire(ctx, waitDeadline(ctx))
+	if err != nil {
+		instTiming(ks, "batch", err, start)
+		return err
+	}
+	defer release()
+
+	batch := session.NewBatch(batchType)
+	batch.Cons = cfg.writeCl
+	for i, stmt := range stmts {
+		batch.Query(stmt, params[i]...)
+	}
+
+	err = classifyErr(session.ExecuteBatch(batch))
+	instTiming(ks, "batch", err, start)
+	observeCheckoutTimeout(ks, err)
+	log.Tracef("%s Atomic batch of %d statements took %s", logPrefix(ctx, ks), len(stmts), time.Since(start).String())
 	return err
 }
 
-func (e *gocqlExecutor) ExecuteAtomically(stmt []string, params [][]interface{}) error {
-	return errors.New("Execute atomically is not implemented yet")
+// executorFor returns the (shared) gocqlExecutor for the given keyspace, creating it if necessary
+func executorFor(ks string) *gocqlExecutor {
+	ksConnectionsMtx.RLock()
+	e, ok := ksExecutors[ks]
+	ksConnectionsMtx.RUnlock()
+	if ok {
+		return e
+	}
+
+	ksConnectionsMtx.Lock()
+	defer ksConnectionsMtx.Unlock()
+	if e, ok = ksExecutors[ks]; !ok { // Guard against race
+		e = &gocqlExecutor{
+			ks: ks,
+		}
+		ksExecutors[ks] = e
+	}
+	return e
 }
 
 func gocqlConnector(ks string) gocassa.Connection {
@@ -185,12 +675,14 @@ func gocqlConnector(ks string) gocassa.Connection {
 		return conn
 	}
 
+	e := executorFor(ks)
 	ksConnectionsMtx.Lock()
 	defer ksConnectionsMtx.Unlock()
 	if conn, ok = ksConnections[ks]; !ok { // Guard against race
-		conn = gocassa.NewConnection(&gocqlExecutor{
-			ks: ks,
-		})
+		conn = connection{
+			Connection: gocassa.NewConnection(e),
+			executor:   e,
+		}
 		ksConnections[ks] = conn
 	}
 	return conn
@@ -0,0 +1,52 @@
+package gocassa
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+func TestReloadRetryDelay(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := reloadRetryDelay(0)
+		assert.True(t, d >= reloadRetryBaseDelay/2 && d <= reloadRetryBaseDelay, "Unexpected delay %s", d)
+
+		d = reloadRetryDelay(2)
+		assert.True(t, d >= 2*time.Second && d <= 4*time.Second, "Unexpected delay %s", d)
+
+		d = reloadRetryDelay(100)
+		assert.True(t, d >= reloadRetryMaxDelay/2 && d <= reloadRetryMaxDelay, "Unexpected delay %s", d)
+	}
+}
+
+func TestReloadNowInvalidConfig(t *testing.T) {
+	// Config which fails validation, so the reload fails (without reaching Cassandra) when the session is built
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"hosts": ["10.0.0.1"],
+		"defaults": {"maxBatchStatements": -1}
+	}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	invalid := "Invalid config for keyspace reload_ks: maxBatchStatements must not be negative (got -1)"
+
+	// Before a session is established, the error is that of initialising the executor
+	assert.EqualError(t, (&gocqlExecutor{ks: "reload_ks"}).ReloadNow(), invalid)
+
+	// Once one is, the reload is applied by the executor's watchConfig goroutine; it's stood in for here
+	e := &gocqlExecutor{ks: "reload_ks", initialised: true, reloadCh: make(chan chan error)}
+	e.swapSession(&sessionRef{close: func() {}}, ksConfig{ks: "reload_ks", maxRows: 10})
+	retryCh := make(chan struct{}, 1)
+	go func() {
+		done := <-e.reloadCh
+		done <- e.reloadSession(retryCh)
+	}()
+
+	assert.EqualError(t, e.ReloadNow(), invalid)
+	_, cfg, done := e.sessionWithConfig()
+	done()
+	assert.Equal(t, 10, cfg.maxRows, "The previous config should be retained")
+	assert.Equal(t, 1, e.reloadFailures, "The failed reload should be retried")
+}
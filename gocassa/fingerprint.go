@@ -0,0 +1,66 @@
+package gocassa
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// Fingerprint labels are truncated to this length, to keep metric names manageable
+	maxFingerprintLabelLength = 100
+	// Fingerprints of at most this many distinct statements are cached
+	maxCachedFingerprints = 1000
+)
+
+var (
+	fpStringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	fpUuidLiteral   = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	fpBlobLiteral   = regexp.MustCompile(`\b0[xX][0-9a-fA-F]*\b`)
+	fpNumberLiteral = regexp.MustCompile(`(^|[^\w.])-?\d+(?:\.\d+)?(?:[eE][-+]?\d+)?\b`)
+	fpBoolLiteral   = regexp.MustCompile(`(?i)\b(?:true|false)\b`)
+	fpWhitespace    = regexp.MustCompile(`\s+`)
+	fpMarkerList    = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+	fpLabelInvalid  = regexp.MustCompile(`[^a-z0-9]+`)
+
+	fingerprints    = map[string]string{}
+	fingerprintsMtx sync.RWMutex
+)
+
+// fingerprint returns the shape of stmt: its literals are replaced with bind markers (and lists of them collapsed to
+// one) and its whitespace normalised, so that statements which differ only in their values share a fingerprint. For
+// example, "SELECT * FROM users WHERE id IN (1, 2)" becomes "SELECT * FROM users WHERE id IN (?)".
+func fingerprint(stmt string) string {
+	fp := fpStringLiteral.ReplaceAllLiteralString(stmt, "?")
+	fp = fpUuidLiteral.ReplaceAllLiteralString(fp, "?")
+	fp = fpBlobLiteral.ReplaceAllLiteralString(fp, "?")
+	fp = fpNumberLiteral.ReplaceAllString(fp, "${1}?")
+	fp = fpBoolLiteral.ReplaceAllLiteralString(fp, "?")
+	fp = fpWhitespace.ReplaceAllLiteralString(fp, " ")
+	fp = fpMarkerList.ReplaceAllLiteralString(fp, "?")
+	return strings.TrimSpace(fp)
+}
+
+// fingerprintLabel returns stmt's fingerprint in a form usable in a metric name (eg. "select_from_users_where_id").
+// Labels are cached, as most statements are repeated (with bind markers rather than literals).
+func fingerprintLabel(stmt string) string {
+	fingerprintsMtx.RLock()
+	label, ok := fingerprints[stmt]
+	fingerprintsMtx.RUnlock()
+	if ok {
+		return label
+	}
+
+	label = strings.ToLower(strings.Replace(fingerprint(stmt), "?", "", -1))
+	label = strings.Trim(fpLabelInvalid.ReplaceAllLiteralString(label, "_"), "_")
+	if len(label) > maxFingerprintLabelLength {
+		label = label[:maxFingerprintLabelLength]
+	}
+
+	fingerprintsMtx.Lock()
+	if len(fingerprints) < maxCachedFingerprints {
+		fingerprints[stmt] = label
+	}
+	fingerprintsMtx.Unlock()
+	return label
+}
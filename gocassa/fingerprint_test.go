@@ -0,0 +1,25 @@
+package gocassa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprintIgnoresLiterals(t *testing.T) {
+	a := fingerprint("SELECT * FROM users WHERE id = 'abc' AND age > 21 LIMIT 10")
+	b := fingerprint("SELECT *  FROM users\n\tWHERE id = 'it''s'   AND age > -3.5 LIMIT 100")
+	assert.Equal(t, "SELECT * FROM users WHERE id = ? AND age > ? LIMIT ?", a)
+	assert.Equal(t, a, b)
+
+	assert.Equal(t, "SELECT * FROM users WHERE id IN (?)",
+		fingerprint("SELECT * FROM users WHERE id IN (5d8c4b0e-1f2a-4c3b-9d6e-7a8b9c0d1e2f, 0xcafe, ?)"))
+	assert.Equal(t, "UPDATE users2 SET active = ? WHERE id = ?",
+		fingerprint("UPDATE users2 SET active = true WHERE id = ?"), "Identifiers containing digits should be kept")
+}
+
+func TestFingerprintLabel(t *testing.T) {
+	assert.Equal(t, "select_from_users_where_id", fingerprintLabel("SELECT * FROM users WHERE id = 123"))
+	assert.Equal(t, fingerprintLabel("SELECT * FROM users WHERE id = 123"),
+		fingerprintLabel("SELECT * FROM users WHERE id = ?"))
+}
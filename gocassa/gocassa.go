@@ -1,11 +1,13 @@
 package gocassa
 
 import (
+	"context"
 	"regexp"
 	"strings"
 
 	s "github.com/hailocab/platform-layer/server"
 
+	"github.com/gocql/gocql"
 	"github.com/hailocab/gocassa"
 )
 
@@ -17,6 +19,38 @@ var (
 
 type ConnectorFunc func(ks string) gocassa.Connection
 
+// executor runs the statements of the package-level functions (eg. QueryContext). They take it from the connection
+// returned by Connector, so that statements they run reach a mock injected with MockConnector.
+type executor interface {
+	gocassa.QueryExecutor
+	QueryContext(ctx context.Context, stmt string, params ...interface{}) ([]map[string]interface{}, error)
+	QueryIdempotent(ctx context.Context, stmt string, params ...interface{}) ([]map[string]interface{}, error)
+	QueryWithStats(stmt string, params ...interface{}) ([]map[string]interface{}, QueryStats, error)
+	QueryIdempotentWithStats(ctx context.Context, stmt string, params ...interface{}) ([]map[string]interface{},
+		QueryStats, error)
+	QueryOrderedContext(ctx context.Context, stmt string, params ...interface{}) ([]string, [][]interface{}, error)
+	ExecuteContext(ctx context.Context, stmt string, params ...interface{}) error
+	ExecuteIdempotent(ctx context.Context, stmt string, params ...interface{}) error
+	ExecuteWithTimestamp(ts int64, stmt string, params ...interface{}) error
+	ExecuteCAS(ctx context.Context, stmt string, params ...interface{}) (bool, map[string]interface{}, error)
+	IncrementCounter(table, column string, delta int64, where string, params ...interface{}) error
+}
+
+// connection is the gocassa.Connection returned by our ConnectorFuncs, exposing the executor it runs statements with
+type connection struct {
+	gocassa.Connection
+	executor executor
+}
+
+// executorOf returns the executor of the named keyspace's connection (see Connector). If Connector has been replaced
+// with a ConnectorFunc of another package's, whose connections don't expose one, it's the keyspace's gocqlExecutor.
+func executorOf(ks string) executor {
+	if conn, ok := Connector(ks).(connection); ok {
+		return conn.executor
+	}
+	return executorFor(ks)
+}
+
 // Returns a configured keyspace for this service. The name is composed from the service name, but this is not
 // relevant to the caller. If the name of the keyspace is important, use KeySpaceWithName.
 func KeySpace() gocassa.KeySpace {
@@ -35,3 +69,203 @@ func KeySpaceWithName(ks string) gocassa.KeySpace {
 	conn := Connector(ks)
 	return conn.KeySpace(ks)
 }
+
+// QueryOrdered runs a query against the named keyspace, returning the column names in SELECT order along with
+// positional rows. Use this over the map-based gocassa API when the ordering of columns matters (eg. when rendering
+// results as a table).
+func QueryOrdered(ks, stmt string, params ...interface{}) ([]string, [][]interface{}, error) {
+	return QueryOrderedContext(context.Background(), ks, stmt, params...)
+}
+
+// QueryOrderedContext behaves like QueryOrdered, but is bound by ctx (see QueryContext)
+func QueryOrderedContext(ctx context.Context, ks, stmt string, params ...interface{}) ([]string, [][]interface{},
+	error) {
+
+	return executorOf(ks).QueryOrderedContext(ctx, stmt, params...)
+}
+
+// Ping runs a trivial query against the named keyspace, returning an error if the cluster can't be reached. It is run
+// at hailo/service/cassandra/defaults/healthCheckConsistencyLevel (see PingHealthCheck).
+func Ping(ks string) error {
+	return executorFor(ks).Ping()
+}
+
+// PingContext behaves like Ping, but abandons the ping once ctx is done
+func PingContext(ctx context.Context, ks string) error {
+	return executorFor(ks).PingContext(ctx)
+}
+
+// KeyspaceMetadata returns the schema metadata for the named keyspace (eg. for schema introspection), using the
+// keyspace's pooled session rather than opening a new one
+func KeyspaceMetadata(ks string) (*gocql.KeyspaceMetadata, error) {
+	return executorFor(ks).KeyspaceMetadata()
+}
+
+// ExecuteAtomically executes the statements against the named keyspace as a single logged batch, so that either all
+// of them are applied or none are. params[i] holds the parameters bound to stmts[i].
+//
+// Logged batches are for atomicity, not throughput: the coordinator must hold the whole batch (and write it to the
+// batchlog) before applying it. Cassandra warns about batches over 5KB (batch_size_warn_threshold_in_kb) and rejects
+// those over 50KB (batch_size_fail_threshold_in_kb) by default, and a few tens of statements, ideally within a single
+// partition, is a sensible upper bound. If the keyspace's maxBatchStatements is set, larger batches fail with an
+// error wrapping ErrBatchTooLarge without being attempted; callers with more work should split it into several batches
+// (accepting that each is then atomic on its own).
+//
+// Batches of counter updates (see IncrementCounter) are executed as counter batches, which aren't logged and so aren't
+// atomic; a batch mixing counter updates with other mutations fails with an error wrapping ErrMixedCounterBatch.
+func ExecuteAtomically(ks string, stmts []string, params [][]interface{}) error {
+	return executorOf(ks).ExecuteAtomically(stmts, params)
+}
+
+// IncrementCounter adds delta (which may be negative) to the counter column of the rows of table, in the named
+// keyspace, matched by where; params are bound to where's bind markers. For example:
+//
+//	IncrementCounter(ks, "page_views", "views", 1, "page = ?", "/home")
+//
+// executes "UPDATE page_views SET views = views + ? WHERE page = ?". To update several counters at once, pass the
+// statements to ExecuteAtomically, which executes them as a counter batch.
+func IncrementCounter(ks, table, column string, delta int64, where string, params ...interface{}) error {
+	return executorOf(ks).IncrementCounter(table, column, delta, where, params...)
+}
+
+// ValidateConfig builds the current config for the named keyspace and checks that it could be applied, without applying
+// it: the config is validated and a throwaway session is opened (and queried) against the cluster. Config reloads make
+// the same checks before swapping a new config in, and keep the previous session if they fail.
+func ValidateConfig(ks string) error {
+	cfg, err := getKsConfig(ks)
+	if err != nil {
+		return err
+	}
+
+	session, err := buildSession(cfg, true)
+	if err != nil {
+		return err
+	}
+	session.Close()
+	return nil
+}
+
+// NewSingleHostConnection returns a connection to the named keyspace which uses a single connection to a single host,
+// bypassing the host pool. This is intended for schema migrations and one-off admin scripts where the pool's
+// complexity is undesirable.
+//
+// Note the limitations: there is no failover (if the host is down, every query fails), all queries share the one
+// connection, and config changes are not picked up after the connection is first used. Authentication, timeouts and
+// consistency are taken from config as for regular connections.
+func NewSingleHostConnection(ks, host string) gocassa.Connection {
+	return gocassa.NewConnection(&gocqlExecutor{
+		ks:         ks,
+		singleHost: host,
+	})
+}
+
+// QueryContext runs a query against the named keyspace, bound by ctx: its deadline limits both how long we wait for a
+// connection and the execution of the query itself. If ctx carries a request id (see WithRequestId), it is included in
+// the query's log lines.
+func QueryContext(ctx context.Context, ks, stmt string, params ...interface{}) ([]map[string]interface{}, error) {
+	return executorOf(ks).QueryContext(ctx, stmt, params...)
+}
+
+// ExecuteContext executes a statement against the named keyspace, bound by ctx: its deadline limits both how long we
+// wait for a connection and the execution of the statement itself. As with QueryContext, a request id carried by ctx is
+// included in the statement's log lines.
+func ExecuteContext(ctx context.Context, ks, stmt string, params ...interface{}) error {
+	return executorOf(ks).ExecuteContext(ctx, stmt, params...)
+}
+
+// QueryIdempotent runs a query against the named keyspace like QueryContext, but marks it as idempotent so that it is
+// eligible for automatic retry. Reads are retried up to hailo/service/cassandra/defaults/read/maxRetries times (which
+// defaults to maxRetries), and made at the consistency of the keyspace's read policy like other queries.
+func QueryIdempotent(ctx context.Context, ks, stmt string, params ...interface{}) ([]map[string]interface{}, error) {
+	return executorOf(ks).QueryIdempotent(ctx, stmt, params...)
+}
+
+// QueryWithStats runs a query against the named keyspace like Query, also returning how it was executed: the number of
+// attempts made, the total latency, and the hosts used
+func QueryWithStats(ks, stmt string, params ...interface{}) ([]map[string]interface{}, QueryStats, error) {
+	return executorOf(ks).QueryWithStats(stmt, params...)
+}
+
+// QueryIdempotentWithStats runs a query against the named keyspace like QueryIdempotent, also returning how it was
+// executed. As only idempotent queries are retried, this is the way to see how many retries a query needed.
+func QueryIdempotentWithStats(ctx context.Context, ks, stmt string, params ...interface{}) ([]map[string]interface{},
+	QueryStats, error) {
+
+	return executorOf(ks).QueryIdempotentWithStats(ctx, stmt, params...)
+}
+
+// ExecuteIdempotent executes a statement against the named keyspace like ExecuteContext, but marks it as idempotent so
+// that it is eligible for automatic retry.
+//
+// Only the *Idempotent functions are ever automatically retried (up to hailo/service/cassandra/defaults/maxRetries
+// times, subject to the retry budget); statements run by any other means, including via the gocassa API, are not. Only
+// use this for statements which are safe to apply more than once: counter updates, list appends and the like must not
+// be executed this way.
+func ExecuteIdempotent(ctx context.Context, ks, stmt string, params ...interface{}) error {
+	return executorOf(ks).ExecuteIdempotent(ctx, stmt, params...)
+}
+
+// ExecuteCAS executes a conditional statement (a lightweight transaction, eg. "INSERT ... IF NOT EXISTS") against the
+// named keyspace, bound by ctx, returning whether it was applied; if not, existing holds the current values of the
+// columns in the condition. The Paxos phase is run at hailo/service/cassandra/serialConsistency/<ks> (or
+// defaults/serialConsistencyLevel): SERIAL by default, or LOCAL_SERIAL to keep it within the local datacentre. The
+// same serial consistency applies to conditional statements run by any other means.
+func ExecuteCAS(ctx context.Context, ks, stmt string, params ...interface{}) (applied bool,
+	existing map[string]interface{}, err error) {
+
+	return executorOf(ks).ExecuteCAS(ctx, stmt, params...)
+}
+
+// ExecuteWithTimestamp executes a statement against the named keyspace, applying its mutations with the given write
+// timestamp (in microseconds since the epoch). Cassandra resolves conflicting writes by timestamp, so this gives the
+// caller explicit control over which write wins. It requires protoVersion 3 or later.
+func ExecuteWithTimestamp(ks string, ts int64, stmt string, params ...interface{}) error {
+	return executorOf(ks).ExecuteWithTimestamp(ts, stmt, params...)
+}
+
+// ReloadNow re-reads the named keyspace's config and applies it if it has changed (rebuilding the session), returning
+// once that is done. Config changes are normally picked up automatically; this allows a reload to be forced (eg. after
+// changing hosts' DNS) or awaited in tests. If the new config can't be applied the previous one is retained, and the
+// error returned. It fails for connections which don't reload their config (see NewSingleHostConnection).
+func ReloadNow(ks string) error {
+	return executorFor(ks).ReloadNow()
+}
+
+// EffectiveConfig returns the config currently applied to the named keyspace's session. ok is false if no session has
+// been established for the keyspace yet.
+func EffectiveConfig(ks string) (cfg Config, ok bool) {
+	ksConnectionsMtx.RLock()
+	e, exists := ksExecutors[ks]
+	ksConnectionsMtx.RUnlock()
+	if !exists {
+		return Config{}, false
+	}
+
+	e.RLock()
+	defer e.RUnlock()
+	if e.session == nil {
+		return Config{}, false
+	}
+	return e.cfg.effective(), true
+}
+
+// HostScores returns how the named keyspace's host pool has observed each Cassandra host to perform, revealing which
+// hosts it is down-weighting. Scores are reset when the session is rebuilt (eg. on a config change), and are empty for
+// keyspaces which haven't established a session or don't use the host pool (see NewSingleHostConnection, and
+// hailo/service/cassandra/localDatacentre).
+func HostScores(ks string) []HostScore {
+	ksConnectionsMtx.RLock()
+	e, exists := ksExecutors[ks]
+	ksConnectionsMtx.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	e.RLock()
+	hp := e.cfg.hostPool
+	e.RUnlock()
+	if hp == nil {
+		return nil
+	}
+	return hp.scores()
+}
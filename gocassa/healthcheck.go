@@ -1,6 +1,7 @@
 package gocassa
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -12,6 +13,8 @@ import (
 const (
 	HealthCheckId  = "com.hailocab.service.cassandra-gocassa"
 	MaxConnCheckId = "com.hailocab.service.cassandra-gocassa.maxconns"
+	MinConnCheckId = "com.hailocab.service.cassandra-gocassa.minconns"
+	PingCheckId    = "com.hailocab.service.cassandra-gocassa.ping"
 )
 
 // HealthCheck verifies we can connect to the supplied C* keyspace, and verifies the passed column families exist
@@ -48,3 +51,40 @@ func MaxConnHealthCheck(maxconns int) healthcheck.Checker {
 		return connhealthcheck.MaxTcpConnections(getHosts(), maxconns)()
 	}
 }
+
+// MinConnHealthCheck asserts that the total number of established connections to all C* nodes is at least a given
+// min threshold, catching a connection pool which has silently lost its connections. gocql doesn't expose the size of
+// its pool, so (as with MaxConnHealthCheck) established TCP connections are counted.
+func MinConnHealthCheck(minconns int) healthcheck.Checker {
+	return func() (map[string]string, error) {
+		return connhealthcheck.MinTcpConnections(getHosts(), minconns)()
+	}
+}
+
+// PingHealthCheck asserts we can run a trivial query against the supplied keyspace, using the same executor (and hence
+// connection pool) as regular queries.
+//
+// The query is run at hailo/service/cassandra/defaults/healthCheckConsistencyLevel, which defaults to LOCAL_ONE: the
+// check then passes as long as the node we're talking to can serve it, which reflects whether this service is usable.
+// At a higher level (eg. QUORUM) it instead reflects the availability of the cluster's replicas, so losing a single
+// node may fail the check (and take the service out of rotation) even though queries at LOCAL_ONE would still succeed.
+// Only raise it if the service genuinely can't function without a quorum.
+func PingHealthCheck(ks string) healthcheck.Checker {
+	return func() (map[string]string, error) {
+		if err := Ping(ks); err != nil {
+			return nil, fmt.Errorf("Cassandra ping failed: %v", err)
+		}
+		return nil, nil
+	}
+}
+
+// PingHealthCheckContext behaves like PingHealthCheck, but abandons the ping once ctx is done (eg. when the runner's
+// deadline passes)
+func PingHealthCheckContext(ks string) healthcheck.CheckerContext {
+	return func(ctx context.Context) (map[string]string, error) {
+		if err := PingContext(ctx, ks); err != nil {
+			return nil, fmt.Errorf("Cassandra ping failed: %v", err)
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,129 @@
+package gocassa
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/hailocab/go-hostpool"
+)
+
+// Weight given to each new latency sample in a host's moving average
+const hostLatencyAlpha = 0.1
+
+// HostScore describes how a keyspace's host pool has observed a Cassandra host to perform. The epsilon-greedy pool
+// favours hosts with a higher Score (derived from their latency), so hosts with a low Score relative to their peers are
+// being down-weighted.
+type HostScore struct {
+	Host        string
+	Requests    int64
+	Failures    int64
+	MeanLatency time.Duration // Moving average of response times
+	Score       float64
+}
+
+// withHostPool returns c with a host pool built over its hosts, which gocql then uses to select hosts. Pools hold
+// resources (the epsilon-greedy pool runs a goroutine to decay its scores), so this is only done for a config which is
+// being applied (see switchConfig), and the pool is closed with closeHostPool once the config is replaced.
+func (c ksConfig) withHostPool() ksConfig {
+	if c.localDc != "" {
+		c.pool = newDcHostPool(c.ks, c.localDc, c.dcs, c.hosts)
+	} else {
+		calc := &hostpool.LinearEpsilonValueCalculator{}
+		c.hostPool = newObservedHostPool(newEpsilonGreedy(c.hosts, c.decay, calc), calc)
+		c.pool = c.hostPool
+	}
+	c.cc.PoolConfig.HostSelectionPolicy = topologyNotifyingPolicy{
+		HostSelectionPolicy: gocql.HostPoolHostPolicy(c.pool),
+		ks:                  c.ks,
+	}
+	return c
+}
+
+// closeHostPool releases the config's host pool, if it has one
+func (c ksConfig) closeHostPool() {
+	if c.pool != nil {
+		c.pool.Close()
+	}
+}
+
+// observedHostPool wraps a HostPool, recording the outcome of each request it routes so that we can see how each host
+// is performing (the pool itself doesn't expose this)
+type observedHostPool struct {
+	hostpool.HostPool
+	calc hostpool.EpsilonValueCalculator
+
+	mtx   sync.Mutex
+	stats map[string]*HostScore
+}
+
+func newObservedHostPool(hp hostpool.HostPool, calc hostpool.EpsilonValueCalculator) *observedHostPool {
+	return &observedHostPool{
+		HostPool: hp,
+		calc:     calc,
+		stats:    map[string]*HostScore{},
+	}
+}
+
+func (p *observedHostPool) Get() hostpool.HostPoolResponse {
+	return &observedHostPoolResponse{
+		HostPoolResponse: p.HostPool.Get(),
+		pool:             p,
+		start:            time.Now(),
+	}
+}
+
+func (p *observedHostPool) record(host string, err error, latency time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	s, ok := p.stats[host]
+	if !ok {
+		s = &HostScore{
+			Host:        host,
+			MeanLatency: latency,
+		}
+		p.stats[host] = s
+	}
+	s.Requests++
+	if err != nil {
+		s.Failures++
+		return
+	}
+	s.MeanLatency = time.Duration(hostLatencyAlpha*float64(latency) + (1-hostLatencyAlpha)*float64(s.MeanLatency))
+}
+
+// scores returns the scores of the hosts which have been used, sorted by host
+func (p *observedHostPool) scores() []HostScore {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	result := make([]HostScore, 0, len(p.stats))
+	for _, s := range p.stats {
+		score := *s
+		if ms := score.MeanLatency.Seconds() * 1000; ms > 0 {
+			score.Score = p.calc.CalcValueFromAvgResponseTime(ms)
+		}
+		result = append(result, score)
+	}
+	sort.Sort(hostScoresByHost(result))
+	return result
+}
+
+type observedHostPoolResponse struct {
+	hostpool.HostPoolResponse
+	pool  *observedHostPool
+	start time.Time
+}
+
+func (r *observedHostPoolResponse) Mark(err error) {
+	r.pool.record(r.Host(), err, time.Since(r.start))
+	r.HostPoolResponse.Mark(err)
+}
+
+type hostScoresByHost []HostScore
+
+func (s hostScoresByHost) Len() int           { return len(s) }
+func (s hostScoresByHost) Less(i, j int) bool { return s[i].Host < s[j].Host }
+func (s hostScoresByHost) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
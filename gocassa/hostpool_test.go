@@ -0,0 +1,24 @@
+package gocassa
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hailocab/go-hostpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObservedHostPool(t *testing.T) {
+	calc := &hostpool.LinearEpsilonValueCalculator{}
+	p := newObservedHostPool(hostpool.NewEpsilonGreedy([]string{"10.0.0.1:9042"}, 0, calc), calc)
+
+	p.Get().Mark(nil)
+	p.Get().Mark(errors.New("Simulated failure"))
+
+	scores := p.scores()
+	if assert.Len(t, scores, 1) {
+		assert.Equal(t, "10.0.0.1:9042", scores[0].Host)
+		assert.Equal(t, int64(2), scores[0].Requests)
+		assert.Equal(t, int64(1), scores[0].Failures)
+	}
+}
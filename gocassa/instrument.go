@@ -0,0 +1,57 @@
+package gocassa
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	inst "github.com/hailocab/service-layer/instrumentation"
+)
+
+const (
+	// Sample rate of timing events for Cassandra
+	timingSampleRate = 0.33
+)
+
+// metricName returns the instrumentation bucket for a Cassandra metric. Buckets are namespaced by keyspace so that
+// services talking to several keyspaces can distinguish them.
+func metricName(ks, metric string) string {
+	return fmt.Sprintf("cassandra.%s.%s", ks, metric)
+}
+
+// instTiming records the time since t against the keyspace's bucket for op, suffixed by the outcome
+func instTiming(ks, op string, err error, t time.Time) {
+	key := metricName(ks, op)
+	if err == nil {
+		key += ".success"
+	} else {
+		key += ".failure"
+	}
+	inst.Timing(timingSampleRate, key, time.Since(t))
+}
+
+// instStatementTiming records the time since t against a bucket for the shape of stmt (see fingerprint), so that
+// latency can be broken down by query without a bucket per distinct statement text
+func instStatementTiming(ks, stmt string, err error, t time.Time) {
+	instTiming(ks, "statement."+fingerprintLabel(stmt), err, t)
+}
+
+// observeSlow logs stmt (by its fingerprint, so that no values are logged) at WARN if it took longer than the keyspace's
+// slowQueryThreshold, and counts it. It returns whether the statement was slow.
+func observeSlow(ctx context.Context, cfg ksConfig, stmt string, took time.Duration) bool {
+	if cfg.slow <= 0 || took <= cfg.slow {
+		return false
+	}
+
+	instCounter(cfg.ks, "slow")
+	log.Warnf("%s Slow statement took %s (threshold %s): %s", logPrefix(ctx, cfg.ks), took.String(), cfg.slow.String(),
+		cfg.loggable(fingerprint(stmt)))
+	return true
+}
+
+// instCounter increments the keyspace's counter bucket for metric
+func instCounter(ks, metric string) {
+	inst.Counter(1.0, metricName(ks, metric), 1)
+}
@@ -0,0 +1,44 @@
+package gocassa
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	inst "github.com/hailocab/service-layer/instrumentation"
+)
+
+func TestMetricNameIncludesKeyspace(t *testing.T) {
+	assert.Equal(t, "cassandra.foo_ks.query", metricName("foo_ks", "query"))
+	assert.NotEqual(t, metricName("ks1", "query"), metricName("ks2", "query"))
+}
+
+func TestInstTimingNamespacedByKeyspace(t *testing.T) {
+	inst.SaveTiming("cassandra.timing_ks.query.success")
+	inst.SaveTiming("cassandra.timing_ks.query.failure")
+	inst.SaveCounter("cassandra.timing_ks.retries")
+
+	instTiming("timing_ks", "query", nil, time.Now())
+	instTiming("timing_ks", "query", errors.New("boom"), time.Now())
+	instCounter("timing_ks", "retries")
+
+	assert.Equal(t, int64(1), inst.GetTiming("cassandra.timing_ks.query.success").Count())
+	assert.Equal(t, int64(1), inst.GetTiming("cassandra.timing_ks.query.failure").Count())
+	assert.Equal(t, int64(1), inst.GetCounter("cassandra.timing_ks.retries").Count())
+}
+
+func TestObserveSlow(t *testing.T) {
+	inst.SaveCounter("cassandra.slow_ks.slow")
+	cfg := ksConfig{ks: "slow_ks"}
+	stmt := "SELECT * FROM users WHERE id = 'dave'"
+
+	assert.False(t, observeSlow(context.Background(), cfg, stmt, time.Hour), "disabled without a threshold")
+
+	cfg.slow = time.Second
+	assert.False(t, observeSlow(context.Background(), cfg, stmt, time.Second))
+	assert.True(t, observeSlow(context.Background(), cfg, stmt, 2*time.Second))
+	assert.Equal(t, int64(1), inst.GetCounter("cassandra.slow_ks.slow").Count())
+}
@@ -0,0 +1,103 @@
+//go:build integration
+// +build integration
+
+// (relies on having a running Cassandra with a "testing" keyspace)
+
+package gocassa
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+func loadConfig() {
+	buf := bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"hosts": ["localhost:9042"]}}}}`)
+	config.Load(buf)
+}
+
+func TestExecuteAtomically(t *testing.T) {
+	loadConfig()
+	ks := "testing"
+
+	assert.NoError(t, Ping(ks))
+	assert.NoError(t, executorFor(ks).Execute(
+		"CREATE TABLE IF NOT EXISTS atomic_test (id text PRIMARY KEY, val text)"))
+
+	err := ExecuteAtomically(ks, []string{
+		"INSERT INTO atomic_test (id, val) VALUES (?, ?)",
+		"INSERT INTO atomic_test (id, val) VALUES (?, ?)",
+	}, [][]interface{}{
+		{"a", "foo"},
+		{"b", "bar"},
+	})
+	assert.NoError(t, err)
+
+	rows, err := executorFor(ks).Query("SELECT id, val FROM atomic_test WHERE id IN (?, ?)", "a", "b")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+
+	err = ExecuteAtomically(ks, []string{"INSERT INTO atomic_test (id, val) VALUES (?, ?)"}, nil)
+	assert.Error(t, err, "Mismatched statements and params should fail")
+}
+
+func TestQueryQualifiedKeyspace(t *testing.T) {
+	loadConfig()
+
+	rows, err := executorFor("testing").Query("SELECT release_version FROM system.local")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+}
+
+func TestReloadNow(t *testing.T) {
+	loadConfig()
+	ks := "testing"
+	assert.NoError(t, Ping(ks))
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"hosts": ["localhost:9042"],
+		"defaults": {"maxRows": 1234}
+	}}}}`))
+	defer loadConfig()
+	assert.NoError(t, ReloadNow(ks))
+	cfg, ok := EffectiveConfig(ks)
+	assert.True(t, ok)
+	assert.Equal(t, 1234, cfg.MaxRows, "Config should have been applied by the time ReloadNow returns")
+
+	single := &gocqlExecutor{ks: ks, singleHost: "localhost:9042"}
+	assert.Error(t, single.ReloadNow(), "Single host connections don't reload their config")
+}
+
+func TestQueryDuringReload(t *testing.T) {
+	loadConfig()
+	ks := "testing"
+	assert.NoError(t, Ping(ks))
+
+	// Start a query, and have the config reload before it's run
+	session, _, done := executorFor(ks).sessionWithConfig()
+	defer done()
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"hosts": ["localhost:9042"],
+		"defaults": {"maxRows": 4321}
+	}}}}`))
+	defer loadConfig()
+	assert.NoError(t, ReloadNow(ks))
+
+	var version string
+	assert.NoError(t, session.Query("SELECT release_version FROM system.local").Scan(&version),
+		"A query in flight should be unaffected by the session being replaced")
+}
+
+func TestQueryWithStats(t *testing.T) {
+	loadConfig()
+
+	rows, stats, err := QueryWithStats("testing", "SELECT release_version FROM system.local")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, 1, stats.Attempts)
+	assert.Len(t, stats.Hosts, 1)
+	assert.True(t, stats.Latency > 0)
+}
@@ -0,0 +1,187 @@
+package gocassa
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	inst "github.com/hailocab/service-layer/instrumentation"
+)
+
+var (
+	limiters    = map[string]*concurrencyLimiter{}
+	limitersMtx sync.Mutex
+)
+
+// concurrencyLimiter bounds the number of queries in flight through a keyspace's executor, so that a misbehaving caller
+// can't flood the connection pool. A limit of zero means queries are unlimited (though they are still counted).
+//
+// By default, when the limit is reached, whichever waiter happens to win the race for a released slot takes it, so
+// under sustained contention some callers can be starved. A fair limiter instead queues waiters and hands released
+// slots to them in arrival order, bounding the worst-case wait at some cost to throughput.
+type concurrencyLimiter struct {
+	ks       string
+	limit    int
+	sem      chan struct{} // nil if unlimited or fair
+	fifo     *fifoSlots    // nil unless limited and fair
+	inFlight *int64        // Shared by all of the keyspace's limiters, so it survives a resize
+}
+
+// concurrencyLimiterFor returns the limiter for ks. If the limit (or fairness) has changed, a new limiter is returned
+// (queries holding a slot in the old one release it there).
+func concurrencyLimiterFor(ks string, limit int, fair bool) *concurrencyLimiter {
+	if limit < 0 {
+		limit = 0
+	}
+
+	limitersMtx.Lock()
+	defer limitersMtx.Unlock()
+
+	l, ok := limiters[ks]
+	if ok && l.limit == limit && (l.fifo != nil) == (fair && limit > 0) {
+		return l
+	}
+
+	var inFlight *int64
+	if ok {
+		inFlight = l.inFlight
+	} else {
+		inFlight = new(int64)
+	}
+	l = &concurrencyLimiter{
+		ks:       ks,
+		limit:    limit,
+		inFlight: inFlight,
+	}
+	switch {
+	case limit > 0 && fair:
+		l.fifo = newFifoSlots(limit)
+	case limit > 0:
+		l.sem = make(chan struct{}, limit)
+	}
+	limiters[ks] = l
+	return l
+}
+
+// withLimiter returns c with the keyspace's concurrency limiter, resized to c's limit if that has changed. The limiter
+// is shared by the keyspace's executors, so this is only done for a config which is being applied (see switchConfig).
+func (c ksConfig) withLimiter() ksConfig {
+	c.limiter = concurrencyLimiterFor(c.ks, c.concurrency, c.fair)
+	return c
+}
+
+// acquire takes a slot, waiting until deadline (or ctx is done) for one to become available. The returned function
+// must be called to release the slot.
+func (l *concurrencyLimiter) acquire(ctx context.Context, deadline time.Time) (func(), error) {
+	switch {
+	case l.fifo != nil:
+		if err := l.fifo.acquire(ctx, deadline); err == errSlotTimeout {
+			instCounter(l.ks, "concurrency.rejected")
+			return nil, ErrTooManyConcurrentQueries
+		} else if err != nil {
+			return nil, err
+		}
+	case l.sem != nil:
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			timer := time.NewTimer(deadline.Sub(time.Now()))
+			defer timer.Stop()
+			select {
+			case l.sem <- struct{}{}:
+			case <-timer.C:
+				instCounter(l.ks, "concurrency.rejected")
+				return nil, ErrTooManyConcurrentQueries
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	l.gauge(atomic.AddInt64(l.inFlight, 1))
+	return func() {
+		l.gauge(atomic.AddInt64(l.inFlight, -1))
+		switch {
+		case l.fifo != nil:
+			l.fifo.release()
+		case l.sem != nil:
+			<-l.sem
+		}
+	}, nil
+}
+
+func (l *concurrencyLimiter) gauge(n int64) {
+	inst.Gauge(1.0, metricName(l.ks, "inflight"), int(n))
+}
+
+var errSlotTimeout = errors.New("Timed out waiting for a slot")
+
+// fifoSlots is a counting semaphore which serves waiters in the order they arrived
+type fifoSlots struct {
+	sync.Mutex
+	free    int
+	waiters *list.List // of chan struct{}, each buffered so a slot can be handed over without blocking
+}
+
+func newFifoSlots(n int) *fifoSlots {
+	return &fifoSlots{
+		free:    n,
+		waiters: list.New(),
+	}
+}
+
+// acquire takes a slot, joining the back of the queue if none is free (or others are already waiting). It returns
+// errSlotTimeout if no slot was handed over by deadline, or ctx's error if it was done first.
+func (f *fifoSlots) acquire(ctx context.Context, deadline time.Time) error {
+	f.Lock()
+	if f.free > 0 && f.waiters.Len() == 0 {
+		f.free--
+		f.Unlock()
+		return nil
+	}
+	ready := make(chan struct{}, 1)
+	elem := f.waiters.PushBack(ready)
+	f.Unlock()
+
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		err = errSlotTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	select {
+	case <-ready:
+		// A slot was handed over as we gave up: pass it on
+		f.releaseLocked()
+	default:
+		f.waiters.Remove(elem)
+	}
+	return err
+}
+
+// release returns a slot, handing it straight to the longest-waiting caller if there is one
+func (f *fifoSlots) release() {
+	f.Lock()
+	defer f.Unlock()
+	f.releaseLocked()
+}
+
+func (f *fifoSlots) releaseLocked() {
+	if front := f.waiters.Front(); front != nil {
+		f.waiters.Remove(front)
+		front.Value.(chan struct{}) <- struct{}{}
+		return
+	}
+	f.free++
+}
@@ -0,0 +1,100 @@
+package gocassa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := concurrencyLimiterFor("limited_ks", 2, false)
+	ctx := context.Background()
+
+	release1, err := l.acquire(ctx, time.Now().Add(10*time.Millisecond))
+	assert.NoError(t, err)
+	release2, err := l.acquire(ctx, time.Now().Add(10*time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), *l.inFlight)
+
+	_, err = l.acquire(ctx, time.Now().Add(10*time.Millisecond))
+	assert.Equal(t, ErrTooManyConcurrentQueries, err)
+
+	release1()
+	release3, err := l.acquire(ctx, time.Now().Add(10*time.Millisecond))
+	assert.NoError(t, err, "Slot should have been released")
+
+	release2()
+	release3()
+	assert.Equal(t, int64(0), *l.inFlight)
+}
+
+func TestConcurrencyLimiterResize(t *testing.T) {
+	l := concurrencyLimiterFor("resized_ks", 1, false)
+	assert.True(t, l == concurrencyLimiterFor("resized_ks", 1, false), "Unchanged limit should reuse the limiter")
+
+	release, err := l.acquire(context.Background(), time.Now())
+	assert.NoError(t, err)
+
+	unlimited := concurrencyLimiterFor("resized_ks", 0, false)
+	for i := 0; i < 10; i++ {
+		_, err := unlimited.acquire(context.Background(), time.Now())
+		assert.NoError(t, err)
+	}
+	release()
+	assert.Equal(t, int64(10), *unlimited.inFlight, "In-flight count should be shared across resizes")
+}
+
+func TestFairConcurrencyLimiter(t *testing.T) {
+	l := concurrencyLimiterFor("fair_ks", 1, true)
+	assert.True(t, l == concurrencyLimiterFor("fair_ks", 1, true), "Unchanged limit should reuse the limiter")
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, time.Now().Add(10*time.Millisecond))
+	assert.NoError(t, err)
+	_, err = l.acquire(ctx, time.Now().Add(10*time.Millisecond))
+	assert.Equal(t, ErrTooManyConcurrentQueries, err)
+	assert.Equal(t, 0, l.fifo.waiters.Len(), "Timed out waiter should have left the queue")
+
+	// Waiters are served in the order they arrived
+	const waiters = 5
+	served := make(chan int, waiters)
+	for i := 0; i < waiters; i++ {
+		go func(i int) {
+			release, err := l.acquire(ctx, time.Now().Add(time.Second))
+			if assert.NoError(t, err) {
+				served <- i
+				release()
+			}
+		}(i)
+		for queued := false; !queued; {
+			l.fifo.Lock()
+			queued = l.fifo.waiters.Len() == i+1
+			l.fifo.Unlock()
+		}
+	}
+	release()
+	for i := 0; i < waiters; i++ {
+		assert.Equal(t, i, <-served)
+	}
+
+	release, err = l.acquire(ctx, time.Now())
+	assert.NoError(t, err, "All slots should have been released")
+	release()
+	assert.Equal(t, int64(0), *l.inFlight)
+}
+
+func TestFairConcurrencyLimiterCancelled(t *testing.T) {
+	l := concurrencyLimiterFor("fair_cancelled_ks", 1, true)
+	release, err := l.acquire(context.Background(), time.Now())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = l.acquire(ctx, time.Now().Add(time.Second))
+	assert.Equal(t, context.Canceled, err)
+
+	release()
+	assert.Equal(t, 1, l.fifo.free, "Slot should be free once the waiter has gone")
+}
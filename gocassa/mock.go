@@ -0,0 +1,142 @@
+package gocassa
+
+import (
+	"context"
+
+	log "github.com/cihub/seelog"
+	"github.com/hailocab/gocassa"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockExecutor implements gocassa's QueryExecutor, so that code built on the gocassa API can be unit tested without a
+// Cassandra cluster. Set up the statements expected with On, matching the statement and its parameters (as a slice),
+// and the rows or error to return:
+//
+//	e := &MockExecutor{}
+//	e.On("Query", "SELECT * FROM users WHERE id = ?", []interface{}{"dave"}).
+//		Return([]map[string]interface{}{{"id": "dave"}}, nil)
+//	e.On("Execute", mock.Anything, mock.Anything).Return(nil)
+//
+// then inject it with MockConnector, and check every expected statement was run with e.AssertExpectations(t). Options
+// passed to QueryWithOptions and ExecuteWithOptions aren't matched: those calls are expected as Query and Execute, as
+// are the context-bound, idempotent and timestamped variants (eg. QueryContext and ExecuteWithTimestamp), and counter
+// increments (as the UPDATE they execute). QueryOrdered and ExecuteCAS calls are expected as such:
+//
+//	e.On("QueryOrdered", "SELECT id, name FROM users", []interface{}(nil)).
+//		Return([]string{"id", "name"}, [][]interface{}{{"dave", "Dave"}}, nil)
+//	e.On("ExecuteCAS", "INSERT INTO users (id) VALUES (?) IF NOT EXISTS", []interface{}{"dave"}).
+//		Return(true, map[string]interface{}(nil), nil)
+type MockExecutor struct {
+	mock.Mock
+}
+
+// MockConnector returns a ConnectorFunc which connects every keyspace to e. To use the mock during a test, replace
+// Connector with it (and be sure to set it back to DefaultConnector when the test exits [via a deferred call]). Both
+// keyspaces obtained via Connector (eg. with KeySpace) and the package-level statement functions (eg. QueryContext)
+// then use the mock; those which inspect the session itself (Ping, KeyspaceMetadata and ReloadNow) don't.
+func MockConnector(e *MockExecutor) ConnectorFunc {
+	return func(ks string) gocassa.Connection {
+		return connection{
+			Connection: gocassa.NewConnection(e),
+			executor:   e,
+		}
+	}
+}
+
+func (e *MockExecutor) Query(stmt string, params ...interface{}) ([]map[string]interface{}, error) {
+	log.Tracef("[Cassandra mock] Query(stmt=%s) called", stmt)
+	returnArgs := e.Mock.Called(stmt, params)
+	rows, _ := returnArgs.Get(0).([]map[string]interface{})
+	return rows, returnArgs.Error(1)
+}
+
+func (e *MockExecutor) QueryWithOptions(opts gocassa.Options, stmt string, params ...interface{}) ([]map[string]interface{}, error) {
+	return e.Query(stmt, params...)
+}
+
+func (e *MockExecutor) Execute(stmt string, params ...interface{}) error {
+	log.Tracef("[Cassandra mock] Execute(stmt=%s) called", stmt)
+	returnArgs := e.Mock.Called(stmt, params)
+	return returnArgs.Error(0)
+}
+
+func (e *MockExecutor) ExecuteWithOptions(opts gocassa.Options, stmt string, params ...interface{}) error {
+	return e.Execute(stmt, params...)
+}
+
+func (e *MockExecutor) ExecuteAtomically(stmts []string, params [][]interface{}) error {
+	log.Tracef("[Cassandra mock] ExecuteAtomically(%d statements) called", len(stmts))
+	returnArgs := e.Mock.Called(stmts, params)
+	return returnArgs.Error(0)
+}
+
+func (e *MockExecutor) QueryContext(ctx context.Context, stmt string, params ...interface{}) ([]map[string]interface{},
+	error) {
+
+	return e.Query(stmt, params...)
+}
+
+func (e *MockExecutor) QueryIdempotent(ctx context.Context, stmt string,
+	params ...interface{}) ([]map[string]interface{}, error) {
+
+	return e.Query(stmt, params...)
+}
+
+func (e *MockExecutor) QueryWithStats(stmt string, params ...interface{}) ([]map[string]interface{}, QueryStats,
+	error) {
+
+	rows, err := e.Query(stmt, params...)
+	return rows, QueryStats{}, err
+}
+
+func (e *MockExecutor) QueryIdempotentWithStats(ctx context.Context, stmt string,
+	params ...interface{}) ([]map[string]interface{}, QueryStats, error) {
+
+	rows, err := e.Query(stmt, params...)
+	return rows, QueryStats{}, err
+}
+
+func (e *MockExecutor) QueryOrdered(stmt string, params ...interface{}) ([]string, [][]interface{}, error) {
+	log.Tracef("[Cassandra mock] QueryOrdered(stmt=%s) called", stmt)
+	returnArgs := e.Mock.Called(stmt, params)
+	columns, _ := returnArgs.Get(0).([]string)
+	rows, _ := returnArgs.Get(1).([][]interface{})
+	return columns, rows, returnArgs.Error(2)
+}
+
+func (e *MockExecutor) QueryOrderedContext(ctx context.Context, stmt string, params ...interface{}) ([]string,
+	[][]interface{}, error) {
+
+	return e.QueryOrdered(stmt, params...)
+}
+
+func (e *MockExecutor) ExecuteContext(ctx context.Context, stmt string, params ...interface{}) error {
+	return e.Execute(stmt, params...)
+}
+
+func (e *MockExecutor) ExecuteIdempotent(ctx context.Context, stmt string, params ...interface{}) error {
+	return e.Execute(stmt, params...)
+}
+
+func (e *MockExecutor) ExecuteWithTimestamp(ts int64, stmt string, params ...interface{}) error {
+	return e.Execute(stmt, params...)
+}
+
+func (e *MockExecutor) ExecuteCAS(ctx context.Context, stmt string, params ...interface{}) (bool,
+	map[string]interface{}, error) {
+
+	log.Tracef("[Cassandra mock] ExecuteCAS(stmt=%s) called", stmt)
+	returnArgs := e.Mock.Called(stmt, params)
+	existing, _ := returnArgs.Get(1).(map[string]interface{})
+	return returnArgs.Bool(0), existing, returnArgs.Error(2)
+}
+
+func (e *MockExecutor) IncrementCounter(table, column string, delta int64, where string,
+	params ...interface{}) error {
+
+	stmt, err := counterIncrementStmt(table, column, where)
+	if err != nil {
+		return err
+	}
+	return e.Execute(stmt, append([]interface{}{delta}, params...)...)
+}
@@ -0,0 +1,71 @@
+package gocassa
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMockExecutor(t *testing.T) {
+	e := &MockExecutor{}
+	rows := []map[string]interface{}{{"id": "dave"}}
+	e.On("Query", "SELECT * FROM users WHERE id = ?", []interface{}{"dave"}).Return(rows, nil)
+	e.On("Query", "SELECT * FROM users WHERE id = ?", []interface{}{"bob"}).Return(nil, errors.New("boom"))
+	e.On("Execute", "DELETE FROM users WHERE id = ?", mock.Anything).Return(nil)
+
+	result, err := e.Query("SELECT * FROM users WHERE id = ?", "dave")
+	assert.NoError(t, err)
+	assert.Equal(t, rows, result)
+
+	result, err = e.Query("SELECT * FROM users WHERE id = ?", "bob")
+	assert.EqualError(t, err, "boom")
+	assert.Nil(t, result)
+
+	assert.NoError(t, e.Execute("DELETE FROM users WHERE id = ?", "dave"))
+	e.AssertExpectations(t)
+}
+
+func TestMockConnector(t *testing.T) {
+	e := &MockExecutor{}
+	Connector = MockConnector(e)
+	defer func() { Connector = DefaultConnector }()
+
+	assert.NotNil(t, KeySpaceWithName("mock"))
+	e.AssertExpectations(t)
+}
+
+func TestMockConnectorPackageFunctions(t *testing.T) {
+	e := &MockExecutor{}
+	Connector = MockConnector(e)
+	defer func() { Connector = DefaultConnector }()
+
+	ctx := WithRequestId(context.Background(), "req1")
+	rows := []map[string]interface{}{{"id": "dave"}}
+	e.On("Query", "SELECT * FROM users WHERE id = ?", []interface{}{"dave"}).Return(rows, nil)
+	e.On("QueryOrdered", "SELECT id FROM users", []interface{}(nil)).
+		Return([]string{"id"}, [][]interface{}{{"dave"}}, nil)
+	e.On("Execute", "UPDATE page_views SET views = views + ? WHERE page = ?", []interface{}{int64(1), "/home"}).
+		Return(nil)
+	e.On("ExecuteCAS", "INSERT INTO users (id) VALUES (?) IF NOT EXISTS", []interface{}{"dave"}).
+		Return(false, map[string]interface{}{"id": "dave"}, nil)
+
+	result, err := QueryContext(ctx, "mock", "SELECT * FROM users WHERE id = ?", "dave")
+	assert.NoError(t, err)
+	assert.Equal(t, rows, result)
+
+	columns, ordered, err := QueryOrderedContext(ctx, "mock", "SELECT id FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id"}, columns)
+	assert.Equal(t, [][]interface{}{{"dave"}}, ordered)
+
+	assert.NoError(t, IncrementCounter("mock", "page_views", "views", 1, "page = ?", "/home"))
+
+	applied, existing, err := ExecuteCAS(ctx, "mock", "INSERT INTO users (id) VALUES (?) IF NOT EXISTS", "dave")
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, map[string]interface{}{"id": "dave"}, existing)
+	e.AssertExpectations(t)
+}
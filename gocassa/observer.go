@@ -0,0 +1,198 @@
+package gocassa
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/gocql/gocql"
+)
+
+// PoolObserver receives callbacks about a keyspace's connection pool activity, allowing pool telemetry to be shipped to
+// custom sinks rather than (or as well as) the instrumentation package.
+type PoolObserver interface {
+	// OnCheckout is called when a connection to host is used. reused is false when the connection was newly
+	// established, in which case wait is how long that took; gocql multiplexes queries over established connections so
+	// there is otherwise no wait to report.
+	OnCheckout(host string, reused bool, wait time.Duration)
+	// OnCheckoutTimeout is called when no connection could be obtained. The host is blank if none was selected.
+	OnCheckoutTimeout(host string)
+	// OnConnectError is called when establishing a connection to host fails
+	OnConnectError(host string, err error)
+}
+
+// CheckoutFailureObserver may additionally be implemented by a PoolObserver to be told why connections couldn't be
+// checked out (OnCheckoutTimeout is only called when no connection was available at all)
+type CheckoutFailureObserver interface {
+	OnCheckoutFailure(host string, reason CheckoutFailureReason)
+}
+
+// CheckoutFailureReason describes why no connection could be checked out of a keyspace's pool to run a statement
+type CheckoutFailureReason int
+
+const (
+	// CheckoutNoConnections means no host had an open connection (eg. all are down or backing off)
+	CheckoutNoConnections CheckoutFailureReason = iota
+	// CheckoutNoStreams means connections were open, but all of their streams were in use
+	CheckoutNoStreams
+	// CheckoutConnClosed means the selected connection was closed
+	CheckoutConnClosed
+)
+
+func (r CheckoutFailureReason) String() string {
+	switch r {
+	case CheckoutNoConnections:
+		return "noConnections"
+	case CheckoutNoStreams:
+		return "noStreams"
+	case CheckoutConnClosed:
+		return "connClosed"
+	default:
+		return "unknown"
+	}
+}
+
+// checkoutFailure returns why err (as returned by classifyErr) indicates that no connection could be checked out, if
+// it does
+func checkoutFailure(err error) (CheckoutFailureReason, bool) {
+	switch err {
+	case ErrConnCheckoutTimeout:
+		return CheckoutNoConnections, true
+	case gocql.ErrNoStreams:
+		return CheckoutNoStreams, true
+	case gocql.ErrConnectionClosed:
+		return CheckoutConnClosed, true
+	}
+	return 0, false
+}
+
+type noopPoolObserver struct{}
+
+func (noopPoolObserver) OnCheckout(host string, reused bool, wait time.Duration) {}
+func (noopPoolObserver) OnCheckoutTimeout(host string)                           {}
+func (noopPoolObserver) OnConnectError(host string, err error)                   {}
+
+var (
+	poolObservers    = map[string]PoolObserver{}
+	poolObserversMtx sync.RWMutex
+)
+
+// RegisterPoolObserver registers an observer of the named keyspace's connection pool, replacing any existing one.
+// Passing nil restores the default (no-op) observer.
+func RegisterPoolObserver(ks string, o PoolObserver) {
+	poolObserversMtx.Lock()
+	defer poolObserversMtx.Unlock()
+	if o == nil {
+		delete(poolObservers, ks)
+		return
+	}
+	poolObservers[ks] = o
+}
+
+// poolObserver returns the observer registered for ks
+func poolObserver(ks string) PoolObserver {
+	poolObserversMtx.RLock()
+	defer poolObserversMtx.RUnlock()
+	if o, ok := poolObservers[ks]; ok {
+		return o
+	}
+	return noopPoolObserver{}
+}
+
+// observeCheckoutTimeout notifies the keyspace's observer if err indicates a connection couldn't be checked out, and
+// counts the failure by reason (eg. "checkout.failure.noStreams")
+func observeCheckoutTimeout(ks string, err error) {
+	reason, failed := checkoutFailure(err)
+	if !failed {
+		return
+	}
+
+	instCounter(ks, "checkout.failure."+reason.String())
+	o := poolObserver(ks)
+	if reason == CheckoutNoConnections {
+		o.OnCheckoutTimeout("")
+	}
+	if fo, ok := o.(CheckoutFailureObserver); ok {
+		fo.OnCheckoutFailure("", reason)
+	}
+}
+
+// speculativeObserver counts a speculatively executed query's attempts beyond the first (as "speculative"), before
+// passing each attempt on to next. gocql numbers retries and speculative executions together, so retries of such a
+// query are counted too.
+type speculativeObserver struct {
+	ks   string
+	next gocql.QueryObserver
+}
+
+func (o speculativeObserver) ObserveQuery(q gocql.ObservedQuery) {
+	if q.Attempt > 0 {
+		instCounter(o.ks, "speculative")
+	}
+	if o.next != nil {
+		o.next.ObserveQuery(q)
+	}
+}
+
+// gocqlPoolObserver adapts gocql's connect and query observers onto the PoolObserver registered for a keyspace. The
+// observer is looked up on each call, so observers may be registered at any time.
+type gocqlPoolObserver struct {
+	ks         string
+	reconnects *reconnectTracker // nil if reconnects aren't counted
+}
+
+func (o gocqlPoolObserver) ObserveConnect(c gocql.ObservedConnect) {
+	host := c.Host.ConnectAddress().String()
+	if c.Err != nil {
+		poolObserver(o.ks).OnConnectError(host, c.Err)
+		return
+	}
+	if o.reconnects != nil && o.reconnects.connected(host) {
+		// gocql only reconnects to a host once a connection to it has been found dead (closed or erroring)
+		log.Debugf("[Cassandra:%s] Re-established a connection to %s", o.ks, host)
+		instCounter(o.ks, "pool.reconnect."+hostMetricLabel(host))
+	}
+	poolObserver(o.ks).OnCheckout(host, false, c.End.Sub(c.Start))
+}
+
+func (o gocqlPoolObserver) ObserveQuery(q gocql.ObservedQuery) {
+	poolObserver(o.ks).OnCheckout(q.Host.ConnectAddress().String(), true, 0)
+}
+
+// reconnectTracker counts the connections a session establishes to each host, so that those which replace a dead
+// connection (ie. any beyond the pool's initial connections to the host) can be identified.
+//
+// gocql also makes a control connection (used for its own bookkeeping, rather than queries) to one of the hosts, over
+// and above the host's pool. This is the session's first connection, as it's made before the pools are filled, so it
+// isn't counted against its host.
+type reconnectTracker struct {
+	sync.Mutex
+	perHost  int  // Connections initially made to each host
+	control  bool // Whether the control connection has been made
+	connects map[string]int
+}
+
+func newReconnectTracker(perHost int) *reconnectTracker {
+	return &reconnectTracker{
+		perHost:  perHost,
+		connects: map[string]int{},
+	}
+}
+
+// connected records a connection to host, returning whether it replaced one which had died
+func (t *reconnectTracker) connected(host string) bool {
+	t.Lock()
+	defer t.Unlock()
+	if !t.control {
+		t.control = true
+		return false
+	}
+	t.connects[host]++
+	return t.connects[host] > t.perHost
+}
+
+// hostMetricLabel returns host (an address) in a form which may be used in a metric name (eg. "10_0_0_1_9042")
+func hostMetricLabel(host string) string {
+	return strings.NewReplacer(".", "_", ":", "_").Replace(host)
+}
@@ -0,0 +1,50 @@
+package gocassa
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+
+	inst "github.com/hailocab/service-layer/instrumentation"
+)
+
+func TestReconnectTracker(t *testing.T) {
+	tr := newReconnectTracker(2)
+	assert.False(t, tr.connected("10.0.0.1:9042"), "The control connection isn't a reconnect")
+	assert.False(t, tr.connected("10.0.0.1:9042"))
+	assert.False(t, tr.connected("10.0.0.1:9042"))
+	assert.False(t, tr.connected("10.0.0.2:9042"), "Hosts should be tracked independently")
+	assert.False(t, tr.connected("10.0.0.2:9042"))
+	assert.True(t, tr.connected("10.0.0.1:9042"), "Connections beyond the pool's initial ones are reconnects")
+	assert.True(t, tr.connected("10.0.0.2:9042"))
+
+	assert.Equal(t, "10_0_0_1_9042", hostMetricLabel("10.0.0.1:9042"))
+}
+
+// recordingQueryObserver records the attempts it observes
+type recordingQueryObserver struct {
+	attempts []int
+}
+
+func (o *recordingQueryObserver) ObserveQuery(q gocql.ObservedQuery) {
+	o.attempts = append(o.attempts, q.Attempt)
+}
+
+func TestSpeculativeObserver(t *testing.T) {
+	inst.SaveCounter("cassandra.spec_ks.speculative")
+	next := &recordingQueryObserver{}
+	o := speculativeObserver{ks: "spec_ks", next: next}
+
+	o.ObserveQuery(gocql.ObservedQuery{Attempt: 0})
+	assert.Equal(t, int64(0), inst.GetCounter("cassandra.spec_ks.speculative").Count(),
+		"A query's first attempt isn't speculative")
+	o.ObserveQuery(gocql.ObservedQuery{Attempt: 1})
+	o.ObserveQuery(gocql.ObservedQuery{Attempt: 2})
+	assert.Equal(t, int64(2), inst.GetCounter("cassandra.spec_ks.speculative").Count())
+	assert.Equal(t, []int{0, 1, 2}, next.attempts, "Every attempt should be passed on")
+
+	assert.NotPanics(t, func() {
+		speculativeObserver{ks: "spec_ks"}.ObserveQuery(gocql.ObservedQuery{Attempt: 1})
+	})
+}
@@ -0,0 +1,67 @@
+package gocassa
+
+import (
+	"strings"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+// readPolicy governs how a keyspace's queries are made: at which consistency, and how many times they are retried
+type readPolicy struct {
+	cl gocql.Consistency
+	// If set, reads are made at this serial consistency instead of cl, so that they observe the outcome of lightweight
+	// transactions (including any in progress). This is considerably more expensive, as each read takes part in Paxos.
+	serialCl gocql.SerialConsistency
+	// Maximum number of times an idempotent read is retried (see QueryIdempotent), subject to the retry budget
+	retries     int
+	retryPolicy gocql.RetryPolicy // Applies retries; nil if the cluster's policy applies
+}
+
+// readPolicyConfig returns the keyspace's read policy (hailo/service/cassandra/defaults/read). The consistency
+// defaults to readConsistencyLevel (which in turn defaults to cl), and retries to retries.
+func readPolicyConfig(cl gocql.Consistency, retries int) readPolicy {
+	path := []string{"hailo", "service", "cassandra", "defaults", "read"}
+	cl = clOrDefault(config.AtPath("hailo", "service", "cassandra", "defaults", "readConsistencyLevel").AsString(""), cl)
+	return readPolicy{
+		cl:       clOrDefault(config.AtPath(append(path, "consistencyLevel")...).AsString(""), cl),
+		serialCl: serialClFromString(config.AtPath(append(path, "serialConsistencyLevel")...).AsString("")),
+		retries:  config.AtPath(append(path, "maxRetries")...).AsInt(retries),
+	}
+}
+
+// invalidSerialCl stands in for an unknown serial consistency, so that a config naming one fails validation
+const invalidSerialCl = ^gocql.SerialConsistency(0)
+
+// serialClFromString returns the serial consistency named by clStr, zero if it is unset, or invalidSerialCl if it is
+// unknown
+func serialClFromString(clStr string) gocql.SerialConsistency {
+	switch strings.ToLower(clStr) {
+	case "":
+		return 0
+	case "serial":
+		return gocql.Serial
+	case "local_serial", "localserial":
+		return gocql.LocalSerial
+	default:
+		return invalidSerialCl
+	}
+}
+
+// consistency returns the consistency at which reads are made
+func (p readPolicy) consistency() gocql.Consistency {
+	if p.serialCl != 0 {
+		return gocql.Consistency(p.serialCl)
+	}
+	return p.cl
+}
+
+// apply sets q's consistency and retry policy according to the policy
+func (p readPolicy) apply(q *gocql.Query) *gocql.Query {
+	q = q.Consistency(p.consistency())
+	if p.retryPolicy != nil {
+		q = q.RetryPolicy(p.retryPolicy)
+	}
+	return q
+}
@@ -0,0 +1,43 @@
+package gocassa
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+func TestReadPolicyConfig(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{}`))
+	p := readPolicyConfig(gocql.Quorum, 5)
+	assert.Equal(t, gocql.Quorum, p.consistency())
+	assert.Equal(t, 5, p.retries)
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"defaults": {
+		"readConsistencyLevel": "one",
+		"read": {"maxRetries": 1}
+	}}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+	p = readPolicyConfig(gocql.Quorum, 5)
+	assert.Equal(t, gocql.One, p.consistency(), "readConsistencyLevel should still apply")
+	assert.Equal(t, 1, p.retries)
+
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {"defaults": {
+		"readConsistencyLevel": "one",
+		"read": {"consistencyLevel": "local_quorum", "serialConsistencyLevel": "local_serial"}
+	}}}}}`))
+	p = readPolicyConfig(gocql.Quorum, 5)
+	assert.Equal(t, gocql.LocalQuorum, p.cl)
+	assert.Equal(t, gocql.LocalSerial, p.serialCl)
+	assert.Equal(t, gocql.Consistency(gocql.LocalSerial), p.consistency(), "Reads should be made at the serial level")
+}
+
+func TestSerialClFromString(t *testing.T) {
+	assert.Equal(t, gocql.SerialConsistency(0), serialClFromString(""))
+	assert.Equal(t, gocql.Serial, serialClFromString("SERIAL"))
+	assert.Equal(t, gocql.LocalSerial, serialClFromString("local_serial"))
+	assert.Equal(t, invalidSerialCl, serialClFromString("bogus"), "Unknown levels should be invalid")
+}
@@ -0,0 +1,43 @@
+package gocassa
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+// Replaces redacted column names in logged statements
+const redactedColumn = "<redacted>"
+
+// redactionConfig returns whether statements logged for ks should be redacted, and the names of any columns which
+// should be redacted from them (hailo/service/cassandra/redaction/<ks>)
+func redactionConfig(ks string) (bool, []string) {
+	enabled := config.AtPath("hailo", "service", "cassandra", "redaction", ks, "enabled").AsBool(false)
+	columns := config.AtPath("hailo", "service", "cassandra", "redaction", ks, "columns").AsStringArray(nil)
+	return enabled, columns
+}
+
+// columnsPattern returns a pattern matching any of columns as a whole identifier, or nil if there are none
+func columnsPattern(columns []string) *regexp.Regexp {
+	quoted := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if c = strings.TrimSpace(c); c != "" {
+			quoted = append(quoted, regexp.QuoteMeta(c))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// redact masks the literal values in stmt (as for fingerprint) and replaces the names of any columns matched by
+// columns
+func redact(stmt string, columns *regexp.Regexp) string {
+	redacted := fingerprint(stmt)
+	if columns != nil {
+		redacted = columns.ReplaceAllLiteralString(redacted, redactedColumn)
+	}
+	return redacted
+}
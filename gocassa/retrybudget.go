@@ -0,0 +1,102 @@
+package gocassa
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/gocql/gocql"
+)
+
+var (
+	retryBudgets    = map[string]*retryBudget{}
+	retryBudgetsMtx sync.Mutex
+)
+
+// retryBudget is a token bucket capping the rate of retries for a keyspace, so that during a cluster-wide brownout
+// every query retrying at once doesn't amplify the load. A rate of zero means retries are unlimited.
+type retryBudget struct {
+	sync.Mutex
+	rate   float64 // Tokens added per second (also the bucket's capacity)
+	tokens float64
+	last   time.Time
+}
+
+// retryBudgetFor returns the (shared) retry budget for ks, adjusting its rate to the supplied value
+func retryBudgetFor(ks string, rate int) *retryBudget {
+	retryBudgetsMtx.Lock()
+	defer retryBudgetsMtx.Unlock()
+
+	b, ok := retryBudgets[ks]
+	if !ok {
+		b = &retryBudget{
+			tokens: float64(rate),
+			last:   time.Now(),
+		}
+		retryBudgets[ks] = b
+	}
+	b.setRate(rate)
+	return b
+}
+
+func (b *retryBudget) setRate(rate int) {
+	b.Lock()
+	defer b.Unlock()
+	b.rate = float64(rate)
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+}
+
+// take attempts to remove a token from the budget, returning whether one was available
+func (b *retryBudget) take() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.rate <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// idempotentQuery is implemented by gocql queries and batches, which can be marked as safe to retry
+type idempotentQuery interface {
+	IsIdempotent() bool
+}
+
+// budgetedRetryPolicy wraps a gocql RetryPolicy, only permitting a retry if the query has been marked as idempotent
+// and the keyspace's retry budget allows it
+type budgetedRetryPolicy struct {
+	gocql.RetryPolicy
+	ks     string
+	budget *retryBudget
+}
+
+func (p *budgetedRetryPolicy) Attempt(q gocql.RetryableQuery) bool {
+	// Retrying a non-idempotent statement risks applying it twice
+	if iq, ok := q.(idempotentQuery); !ok || !iq.IsIdempotent() {
+		return false
+	}
+	if !p.RetryPolicy.Attempt(q) {
+		return false
+	}
+	if !p.budget.take() {
+		log.Debugf("[Cassandra:%s] Retry budget exhausted; not retrying query", p.ks)
+		instCounter(p.ks, "retries.dropped")
+		return false
+	}
+	instCounter(p.ks, "retries")
+	return true
+}
@@ -0,0 +1,53 @@
+package gocassa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBudgetExhausts(t *testing.T) {
+	b := &retryBudget{
+		rate:   2,
+		tokens: 2,
+		last:   time.Now(),
+	}
+
+	assert.True(t, b.take())
+	assert.True(t, b.take())
+	assert.False(t, b.take(), "Budget should be exhausted")
+
+	b.last = b.last.Add(-time.Second)
+	assert.True(t, b.take(), "Budget should have refilled")
+}
+
+func TestRetryBudgetUnlimited(t *testing.T) {
+	b := retryBudgetFor("unlimited_ks", 0)
+	for i := 0; i < 100; i++ {
+		assert.True(t, b.take())
+	}
+}
+
+// retryableQuery is a minimal gocql.RetryableQuery
+type retryableQuery struct {
+	gocql.RetryableQuery
+	attempts   int
+	idempotent bool
+}
+
+func (q *retryableQuery) Attempts() int      { return q.attempts }
+func (q *retryableQuery) IsIdempotent() bool { return q.idempotent }
+
+func TestRetryPolicyOnlyRetriesIdempotent(t *testing.T) {
+	p := &budgetedRetryPolicy{
+		RetryPolicy: &gocql.SimpleRetryPolicy{NumRetries: 3},
+		ks:          "idempotent_ks",
+		budget:      retryBudgetFor("idempotent_ks", 0),
+	}
+
+	assert.False(t, p.Attempt(&retryableQuery{attempts: 1}), "Non-idempotent queries must not be retried")
+	assert.True(t, p.Attempt(&retryableQuery{attempts: 1, idempotent: true}))
+	assert.False(t, p.Attempt(&retryableQuery{attempts: 4, idempotent: true}), "Retries should be exhausted")
+}
@@ -0,0 +1,61 @@
+package gocassa
+
+import (
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+// sessionRef counts the operations using a session, so that when a reload replaces it (see switchConfig) it is only
+// closed once the operations already in flight on it have finished
+type sessionRef struct {
+	session *gocql.Session
+	close   func() // Closes the session, and releases anything it was using
+
+	mtx     sync.Mutex
+	users   int
+	retired bool
+}
+
+// newSessionRef wraps a session built from cfg; once it is retired and unused, both are closed
+func newSessionRef(session *gocql.Session, cfg ksConfig) *sessionRef {
+	return &sessionRef{
+		session: session,
+		close: func() {
+			session.Close()
+			cfg.closeHostPool()
+		},
+	}
+}
+
+// acquire registers a user of the session, returning a func which must be called once it's done with the session
+func (r *sessionRef) acquire() func() {
+	r.mtx.Lock()
+	r.users++
+	r.mtx.Unlock()
+	return r.release
+}
+
+func (r *sessionRef) release() {
+	r.mtx.Lock()
+	r.users--
+	closing := r.retired && r.users == 0
+	r.mtx.Unlock()
+
+	if closing {
+		r.close()
+	}
+}
+
+// retire marks the session as replaced: it is closed now if nothing is using it, and otherwise when its last user is
+// done. It must not be acquired once retired.
+func (r *sessionRef) retire() {
+	r.mtx.Lock()
+	r.retired = true
+	closing := r.users == 0
+	r.mtx.Unlock()
+
+	if closing {
+		r.close()
+	}
+}
@@ -0,0 +1,52 @@
+package gocassa
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionRefClosedOnceUnused(t *testing.T) {
+	closed := 0
+	r := &sessionRef{close: func() { closed++ }}
+	done1, done2 := r.acquire(), r.acquire()
+
+	r.retire()
+	assert.Equal(t, 0, closed, "Session should stay open while in use")
+	done1()
+	assert.Equal(t, 0, closed, "Session should stay open while in use")
+	done2()
+	assert.Equal(t, 1, closed, "Session should be closed once its last user is done")
+
+	r = &sessionRef{close: func() { closed++ }}
+	r.acquire()()
+	assert.Equal(t, 1, closed, "Session should stay open until retired")
+	r.retire()
+	assert.Equal(t, 2, closed, "An unused session should be closed as soon as it's retired")
+}
+
+func TestSwapSessionDuringQuery(t *testing.T) {
+	e := &gocqlExecutor{ks: "swap_ks"}
+	oldClosed, newClosed := false, false
+	oldSession, newSession := &gocql.Session{}, &gocql.Session{}
+	oldCfg := ksConfig{ks: "swap_ks", maxRows: 1, cc: gocql.NewCluster("10.0.0.1")}
+	newCfg := ksConfig{ks: "swap_ks", maxRows: 2, cc: gocql.NewCluster("10.0.0.1")}
+	e.swapSession(&sessionRef{session: oldSession, close: func() { oldClosed = true }}, oldCfg)
+
+	// A query starts on the old session, and the config is reloaded while it's in flight
+	session, cfg, done := e.sessionWithConfig()
+	assert.Equal(t, oldSession, session)
+	assert.Equal(t, 1, cfg.maxRows)
+	e.swapSession(&sessionRef{session: newSession, close: func() { newClosed = true }}, newCfg)
+	assert.False(t, oldClosed, "The old session should stay open for the query in flight")
+
+	session, cfg, done2 := e.sessionWithConfig()
+	assert.Equal(t, newSession, session, "Queries started after the reload should use the new session")
+	assert.Equal(t, 2, cfg.maxRows)
+	done2()
+
+	done()
+	assert.True(t, oldClosed, "The old session should be closed once the query is done")
+	assert.False(t, newClosed)
+}
@@ -0,0 +1,87 @@
+package gocassa
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/hailocab/gocassa"
+)
+
+// QueryStats describes how a query was executed. Queries needing several attempts are a sign of cluster stress.
+type QueryStats struct {
+	Attempts int           // Requests sent to Cassandra, including retries and speculative executions
+	Latency  time.Duration // Total time taken, including waiting for a connection and any retries
+	Hosts    []string      // The host each attempt was sent to, in order
+}
+
+type statsObserverKey struct{}
+
+// statsObserver records each attempt at a query, before passing it on to the next observer (normally the keyspace's
+// own). Speculative attempts may be observed concurrently.
+type statsObserver struct {
+	mtx      sync.Mutex
+	stats    QueryStats
+	observer gocql.QueryObserver
+}
+
+// observeStats returns the stats observer carried by ctx, passing each attempt on to next; or next if ctx carries none
+func observeStats(ctx context.Context, next gocql.QueryObserver) gocql.QueryObserver {
+	o, ok := ctx.Value(statsObserverKey{}).(*statsObserver)
+	if !ok {
+		return next
+	}
+	o.mtx.Lock()
+	o.observer = next
+	o.mtx.Unlock()
+	return o
+}
+
+func (o *statsObserver) ObserveQuery(q gocql.ObservedQuery) {
+	o.mtx.Lock()
+	o.stats.Attempts++
+	o.stats.Hosts = append(o.stats.Hosts, q.Host.ConnectAddress().String())
+	observer := o.observer
+	o.mtx.Unlock()
+
+	if observer != nil {
+		observer.ObserveQuery(q)
+	}
+}
+
+// snapshot returns the stats recorded so far
+func (o *statsObserver) snapshot() QueryStats {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	stats := o.stats
+	stats.Hosts = append([]string(nil), o.stats.Hosts...)
+	return stats
+}
+
+// QueryWithStats behaves like Query, also returning how the query was executed
+func (e *gocqlExecutor) QueryWithStats(stmt string, params ...interface{}) ([]map[string]interface{}, QueryStats,
+	error) {
+
+	return e.queryWithStats(context.Background(), false, stmt, params...)
+}
+
+// QueryIdempotentWithStats behaves like QueryIdempotent, also returning how the query was executed (including any
+// retries)
+func (e *gocqlExecutor) QueryIdempotentWithStats(ctx context.Context, stmt string,
+	params ...interface{}) ([]map[string]interface{}, QueryStats, error) {
+
+	return e.queryWithStats(ctx, true, stmt, params...)
+}
+
+func (e *gocqlExecutor) queryWithStats(ctx context.Context, idempotent bool, stmt string,
+	params ...interface{}) ([]map[string]interface{}, QueryStats, error) {
+
+	o := &statsObserver{}
+	start := time.Now()
+	results, err := e.queryContext(context.WithValue(ctx, statsObserverKey{}, o), gocassa.Options{}, idempotent, stmt,
+		params...)
+	stats := o.snapshot()
+	stats.Latency = time.Since(start)
+	return results, stats, err
+}
@@ -0,0 +1,118 @@
+package gocassa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+func observedQuery(host string, attempt int) gocql.ObservedQuery {
+	return gocql.ObservedQuery{
+		Host:    (&gocql.HostInfo{}).SetConnectAddress(net.ParseIP(host)),
+		Attempt: attempt,
+	}
+}
+
+// countingQueryObserver counts the attempts it observes, and is safe for concurrent use
+type countingQueryObserver struct {
+	n int64
+}
+
+func (o *countingQueryObserver) ObserveQuery(gocql.ObservedQuery) {
+	atomic.AddInt64(&o.n, 1)
+}
+
+func TestStatsObserverSnapshot(t *testing.T) {
+	o := &statsObserver{}
+	o.stats.Attempts = 2
+	o.stats.Hosts = []string{"10.0.0.1", "10.0.0.2"}
+
+	stats := o.snapshot()
+	assert.Equal(t, 2, stats.Attempts)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, stats.Hosts)
+
+	o.stats.Hosts[0] = "10.0.0.3"
+	assert.Equal(t, "10.0.0.1", stats.Hosts[0], "Snapshot shouldn't share the observer's hosts")
+}
+
+func TestStatsObserverRecordsAttempts(t *testing.T) {
+	next := &recordingQueryObserver{}
+	o := &statsObserver{observer: next}
+
+	o.ObserveQuery(observedQuery("10.0.0.1", 0))
+	o.ObserveQuery(observedQuery("10.0.0.2", 1))
+	o.ObserveQuery(observedQuery("10.0.0.1", 2))
+
+	stats := o.snapshot()
+	assert.Equal(t, 3, stats.Attempts)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"}, stats.Hosts, "Hosts should be in order of attempt")
+	assert.Equal(t, []int{0, 1, 2}, next.attempts, "Every attempt should be passed on to the keyspace's observer")
+
+	assert.NotPanics(t, func() {
+		(&statsObserver{}).ObserveQuery(observedQuery("10.0.0.1", 0))
+	}, "An observer with nothing to pass attempts on to should still record them")
+}
+
+func TestStatsObserverConcurrentAttempts(t *testing.T) {
+	// Speculative attempts are observed concurrently
+	next := &countingQueryObserver{}
+	o := &statsObserver{observer: next}
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			o.ObserveQuery(observedQuery(fmt.Sprintf("10.0.0.%d", i+1), i))
+		}(i)
+	}
+	wg.Wait()
+
+	stats := o.snapshot()
+	assert.Equal(t, attempts, stats.Attempts)
+	assert.Len(t, stats.Hosts, attempts)
+	for i := 0; i < attempts; i++ {
+		assert.Contains(t, stats.Hosts, fmt.Sprintf("10.0.0.%d", i+1))
+	}
+	assert.Equal(t, int64(attempts), atomic.LoadInt64(&next.n))
+}
+
+func TestObserveStats(t *testing.T) {
+	next := &countingQueryObserver{}
+	assert.True(t, observeStats(context.Background(), next) == next,
+		"Without a stats observer in the context, attempts should go straight to the next observer")
+
+	o := &statsObserver{}
+	observer := observeStats(context.WithValue(context.Background(), statsObserverKey{}, o), next)
+	assert.True(t, observer == o)
+	observer.ObserveQuery(observedQuery("10.0.0.1", 0))
+	assert.Equal(t, 1, o.snapshot().Attempts)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&next.n))
+}
+
+func TestQueryWithStatsLatency(t *testing.T) {
+	// Config which fails validation, so the query fails (without reaching Cassandra) when the session is built
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"cassandra": {
+		"hosts": ["10.0.0.1"],
+		"defaults": {"maxBatchStatements": -1}
+	}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	e := &gocqlExecutor{ks: "stats_ks"}
+	rows, stats, err := e.QueryWithStats("SELECT * FROM foo")
+	assert.Error(t, err)
+	assert.Nil(t, rows)
+	assert.Equal(t, 0, stats.Attempts)
+	assert.Len(t, stats.Hosts, 0)
+	assert.True(t, stats.Latency > 0, "Latency should be recorded even when the query fails")
+}
@@ -0,0 +1,67 @@
+package gocassa
+
+import (
+	"crypto/tls"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+// tlsOptions describes how (and whether) connections to the cluster are made over TLS
+type tlsOptions struct {
+	enabled    bool
+	caPath     string // PEM file of CAs trusted to sign the nodes' certificates (the system's CAs if unset)
+	certPath   string // PEM file of the client certificate presented to the nodes, if they require one
+	keyPath    string // PEM file of the client certificate's key
+	serverName string // Name the nodes' certificates are verified against (each node's host if unset)
+	insecure   bool   // If set, the nodes' certificates aren't verified; only for testing
+}
+
+// tlsConfig returns the TLS options for connections to the cluster (hailo/service/cassandra/tls)
+func tlsConfig() tlsOptions {
+	path := []string{"hailo", "service", "cassandra", "tls"}
+	return tlsOptions{
+		enabled:    config.AtPath(append(path, "enabled")...).AsBool(false),
+		caPath:     config.AtPath(append(path, "caPath")...).AsString(""),
+		certPath:   config.AtPath(append(path, "certPath")...).AsString(""),
+		keyPath:    config.AtPath(append(path, "keyPath")...).AsString(""),
+		serverName: config.AtPath(append(path, "serverName")...).AsString(""),
+		insecure:   config.AtPath(append(path, "insecureSkipVerify")...).AsBool(false),
+	}
+}
+
+// sslOptions returns the gocql options which apply o, or nil if TLS is disabled. gocql loads the certificates when it
+// connects, so problems with them surface when a session is built.
+func (o tlsOptions) sslOptions() *gocql.SslOptions {
+	if !o.enabled {
+		return nil
+	}
+	return &gocql.SslOptions{
+		Config: &tls.Config{
+			ServerName: o.serverName,
+		},
+		CaPath:                 o.caPath,
+		CertPath:               o.certPath,
+		KeyPath:                o.keyPath,
+		EnableHostVerification: !o.insecure,
+	}
+}
+
+// String describes the options (paths to key material are omitted)
+func (o tlsOptions) String() string {
+	if !o.enabled {
+		return "tls=off"
+	}
+	result := "tls=on"
+	if o.serverName != "" {
+		result += " serverName=" + o.serverName
+	}
+	if o.certPath != "" {
+		result += " clientCert=" + o.certPath
+	}
+	if o.insecure {
+		result += " insecureSkipVerify"
+	}
+	return result
+}
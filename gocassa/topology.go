@@ -0,0 +1,137 @@
+package gocassa
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/gocql/gocql"
+)
+
+// Number of events buffered for each subscriber; events for a subscriber which isn't keeping up are dropped
+const topologyEventBuffer = 64
+
+// TopologyEventType describes a change to a keyspace's cluster
+type TopologyEventType int
+
+const (
+	// NodeUp means a host became reachable
+	NodeUp TopologyEventType = iota
+	// NodeDown means a host became unreachable
+	NodeDown
+	// NodeAdded means a host was added to the session's pool
+	NodeAdded
+	// NodeRemoved means a host was removed from the session's pool
+	NodeRemoved
+)
+
+func (t TopologyEventType) String() string {
+	switch t {
+	case NodeUp:
+		return "up"
+	case NodeDown:
+		return "down"
+	case NodeAdded:
+		return "added"
+	case NodeRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// TopologyEvent is delivered to subscribers when a node in a keyspace's cluster changes state
+type TopologyEvent struct {
+	Keyspace string
+	Host     string
+	Type     TopologyEventType
+	Time     time.Time
+}
+
+var (
+	topologySubscribers    = map[string][]chan TopologyEvent{}
+	topologySubscribersMtx sync.RWMutex
+)
+
+// SubscribeTopologyEvents returns a channel which receives an event whenever a node in the keyspace's cluster goes up
+// or down, or is added to or removed from its pool. The channel is buffered; if the subscriber falls behind, further
+// events are dropped (and counted) rather than holding up the session. Subscribers should call
+// UnsubscribeTopologyEvents once they're no longer interested.
+func SubscribeTopologyEvents(ks string) <-chan TopologyEvent {
+	topologySubscribersMtx.Lock()
+	defer topologySubscribersMtx.Unlock()
+
+	ch := make(chan TopologyEvent, topologyEventBuffer)
+	topologySubscribers[ks] = append(topologySubscribers[ks], ch)
+	return ch
+}
+
+// UnsubscribeTopologyEvents ends a subscription made with SubscribeTopologyEvents, and closes its channel. It's a
+// no-op if the channel isn't subscribed to the keyspace's events.
+func UnsubscribeTopologyEvents(ks string, ch <-chan TopologyEvent) {
+	topologySubscribersMtx.Lock()
+	defer topologySubscribersMtx.Unlock()
+
+	subscribers := topologySubscribers[ks]
+	for i, sub := range subscribers {
+		if (<-chan TopologyEvent)(sub) != ch {
+			continue
+		}
+		subscribers = append(subscribers[:i], subscribers[i+1:]...)
+		if len(subscribers) == 0 {
+			delete(topologySubscribers, ks)
+		} else {
+			topologySubscribers[ks] = subscribers
+		}
+		close(sub)
+		return
+	}
+}
+
+// publishTopologyEvent delivers an event to the keyspace's subscribers
+func publishTopologyEvent(ks, host string, t TopologyEventType) {
+	log.Infof("[Cassandra:%s] Host %s %s", ks, host, t.String())
+	instCounter(ks, "topology."+t.String())
+
+	e := TopologyEvent{
+		Keyspace: ks,
+		Host:     host,
+		Type:     t,
+		Time:     time.Now(),
+	}
+
+	topologySubscribersMtx.RLock()
+	defer topologySubscribersMtx.RUnlock()
+	for _, ch := range topologySubscribers[ks] {
+		select {
+		case ch <- e:
+		default:
+			instCounter(ks, "topology.dropped")
+		}
+	}
+}
+
+// topologyNotifyingPolicy wraps a host selection policy, publishing the host state changes gocql notifies it of
+type topologyNotifyingPolicy struct {
+	gocql.HostSelectionPolicy
+	ks string
+}
+
+func (p topologyNotifyingPolicy) AddHost(host *gocql.HostInfo) {
+	p.HostSelectionPolicy.AddHost(host)
+	publishTopologyEvent(p.ks, host.ConnectAddress().String(), NodeAdded)
+}
+
+func (p topologyNotifyingPolicy) RemoveHost(host *gocql.HostInfo) {
+	p.HostSelectionPolicy.RemoveHost(host)
+	publishTopologyEvent(p.ks, host.ConnectAddress().String(), NodeRemoved)
+}
+
+func (p topologyNotifyingPolicy) HostUp(host *gocql.HostInfo) {
+	p.HostSelectionPolicy.HostUp(host)
+	publishTopologyEvent(p.ks, host.ConnectAddress().String(), NodeUp)
+}
+
+func (p topologyNotifyingPolicy) HostDown(host *gocql.HostInfo) {
+	p.HostSelectionPolicy.HostDown(host)
+	publishTopologyEvent(p.ks, host.ConnectAddress().String(), NodeDown)
+}
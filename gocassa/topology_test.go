@@ -0,0 +1,55 @@
+package gocassa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeTopologyEvents(t *testing.T) {
+	ch1 := SubscribeTopologyEvents("topology_ks")
+	defer UnsubscribeTopologyEvents("topology_ks", ch1)
+	ch2 := SubscribeTopologyEvents("topology_ks")
+	defer UnsubscribeTopologyEvents("topology_ks", ch2)
+	other := SubscribeTopologyEvents("other_topology_ks")
+	defer UnsubscribeTopologyEvents("other_topology_ks", other)
+
+	publishTopologyEvent("topology_ks", "10.0.0.1", NodeDown)
+	for _, ch := range []<-chan TopologyEvent{ch1, ch2} {
+		e := <-ch
+		assert.Equal(t, "topology_ks", e.Keyspace)
+		assert.Equal(t, "10.0.0.1", e.Host)
+		assert.Equal(t, NodeDown, e.Type)
+		assert.False(t, e.Time.IsZero())
+	}
+	assert.Len(t, other, 0, "Events should only be delivered to the keyspace's subscribers")
+}
+
+func TestTopologyEventsDroppedWhenFull(t *testing.T) {
+	ch := SubscribeTopologyEvents("full_topology_ks")
+	defer UnsubscribeTopologyEvents("full_topology_ks", ch)
+	for i := 0; i < topologyEventBuffer+10; i++ {
+		publishTopologyEvent("full_topology_ks", "10.0.0.1", NodeUp)
+	}
+	assert.Len(t, ch, topologyEventBuffer)
+}
+
+func TestUnsubscribeTopologyEvents(t *testing.T) {
+	ch := SubscribeTopologyEvents("stop_topology_ks")
+	other := SubscribeTopologyEvents("stop_topology_ks")
+	defer UnsubscribeTopologyEvents("stop_topology_ks", other)
+
+	UnsubscribeTopologyEvents("stop_topology_ks", ch)
+	_, ok := <-ch
+	assert.False(t, ok, "The channel should be closed once the subscription ends")
+	assert.NotPanics(t, func() {
+		UnsubscribeTopologyEvents("stop_topology_ks", ch)
+		UnsubscribeTopologyEvents("other_topology_ks", other)
+	}, "Unsubscribing a channel which isn't subscribed should be a no-op")
+
+	publishTopologyEvent("stop_topology_ks", "10.0.0.1", NodeUp)
+	assert.Len(t, other, 1, "Other subscribers should still receive events")
+	topologySubscribersMtx.RLock()
+	assert.Len(t, topologySubscribers["stop_topology_ks"], 1)
+	topologySubscribersMtx.RUnlock()
+}
@@ -0,0 +1,33 @@
+package gocassa
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/gocql/gocql"
+)
+
+// traceLogWriter is an io.Writer which logs each write, used as the sink for sampled query traces
+type traceLogWriter struct {
+	cfg    ksConfig
+	prefix string // See logPrefix
+}
+
+func (w traceLogWriter) Write(p []byte) (int, error) {
+	log.Infof("%s Trace: %s", w.prefix, w.cfg.loggable(strings.TrimSpace(string(p))))
+	return len(p), nil
+}
+
+// sampleTrace enables gocql tracing on q for a random fraction (cfg.traceRate) of calls, logging the trace
+// when it is captured. For the untraced majority this costs a single random number.
+func sampleTrace(ctx context.Context, q *gocql.Query, session *gocql.Session, cfg ksConfig) *gocql.Query {
+	if cfg.traceRate <= 0 || rand.Float64() >= cfg.traceRate {
+		return q
+	}
+	return q.Trace(gocql.NewTraceWriter(session, traceLogWriter{
+		cfg:    cfg,
+		prefix: logPrefix(ctx, cfg.ks),
+	}))
+}
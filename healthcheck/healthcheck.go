@@ -1,4 +1,30 @@
 package healthcheck
 
+import (
+	"context"
+	"time"
+)
+
 // Checker is how healthchecks implement the logic for testing health and returning samples
 type Checker func() (measurements map[string]string, err error)
+
+// CheckerContext is a Checker which honours cancellation of its context, so that (for example) a hung probe can be
+// abandoned once a deadline imposed by the runner has passed
+type CheckerContext func(ctx context.Context) (measurements map[string]string, err error)
+
+// WithContext adapts a Checker to a CheckerContext. The Checker itself cannot be interrupted, so the context is
+// ignored.
+func (c Checker) WithContext() CheckerContext {
+	return func(ctx context.Context) (map[string]string, error) {
+		return c()
+	}
+}
+
+// WithTimeout adapts a CheckerContext to a Checker, which runs it with a context that is cancelled after timeout
+func (c CheckerContext) WithTimeout(timeout time.Duration) Checker {
+	return func() (map[string]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return c(ctx)
+	}
+}
@@ -0,0 +1,25 @@
+package healthcheck
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckerAdapters(t *testing.T) {
+	var check Checker = func() (map[string]string, error) {
+		return map[string]string{"foo": "bar"}, nil
+	}
+	m, err := check.WithContext()(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo": "bar"}, m)
+
+	var hung CheckerContext = func(ctx context.Context) (map[string]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	_, err = hung.WithTimeout(10 * time.Millisecond)()
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -30,6 +30,9 @@ type Instrumentation struct {
 	instRusage    bool
 	launched      time.Time
 	mtx           sync.RWMutex
+	pendingMtx    sync.Mutex
+	pending       int        // statsd sends which are in flight, guarded by pendingMtx
+	flushed       *sync.Cond // broadcast whenever pending drops to zero
 	runtimeOnce   sync.Once
 	rusageOnce    sync.Once
 }
@@ -51,6 +54,7 @@ func New() *Instrumentation {
 		instRuntime:   false,
 		instRusage:    false,
 	}
+	inst.flushed = sync.NewCond(&inst.pendingMtx)
 
 	inst.StartRuntime()
 	inst.StartRusage()
@@ -77,7 +81,7 @@ func loadStatsdAddr() string {
 }
 
 func loadStatsd(addr string) g2s.Statter {
-	disabled := config.AtPath("hailo", "service", "instrumentation", "statsd", "disabled").AsBool()
+	disabled := config.AtPath("hailo", "service", "instrumentation", "statsd", "disabled").AsBool(false)
 	if disabled {
 		return g2s.Noop()
 	}
@@ -177,7 +181,9 @@ func (i *Instrumentation) Counter(sampleRate float32, bucket string, n ...int) {
 	i.mtx.RLock()
 	defer i.mtx.RUnlock()
 	if i.statsd != nil {
-		go i.statsd.Counter(sampleRate, fmt.Sprintf("%s.%s", i.namespace, bucket), n...)
+		i.send(func(s g2s.Statter, name string) {
+			s.Counter(sampleRate, name, n...)
+		}, bucket)
 	}
 	if c, exists := i.savedCounters[bucket]; exists {
 		for _, v := range n {
@@ -192,7 +198,9 @@ func (i *Instrumentation) Timing(sampleRate float32, bucket string, d ...time.Du
 	i.mtx.RLock()
 	defer i.mtx.RUnlock()
 	if i.statsd != nil {
-		go i.statsd.Timing(sampleRate, fmt.Sprintf("%s.%s", i.namespace, bucket), d...)
+		i.send(func(s g2s.Statter, name string) {
+			s.Timing(sampleRate, name, d...)
+		}, bucket)
 	}
 	if c, exists := i.savedTimers[bucket]; exists {
 		for _, v := range d {
@@ -212,7 +220,9 @@ func (i *Instrumentation) Gauge(sampleRate float32, bucket string, n ...int) {
 		for i, v := range n {
 			strs[i] = strconv.Itoa(v)
 		}
-		go i.statsd.Gauge(sampleRate, fmt.Sprintf("%s.%s", i.namespace, bucket), strs...)
+		i.send(func(s g2s.Statter, name string) {
+			s.Gauge(sampleRate, name, strs...)
+		}, bucket)
 	}
 	if g, exists := i.savedGauges[bucket]; exists {
 		for _, v := range n {
@@ -221,6 +231,37 @@ func (i *Instrumentation) Gauge(sampleRate float32, bucket string, n ...int) {
 	}
 }
 
+// send asynchronously sends a metric to statsd using f, tracking it so that Flush can wait for it. The caller must
+// hold (at least) a read lock on i.mtx.
+func (i *Instrumentation) send(f func(s g2s.Statter, name string), bucket string) {
+	s, name := i.statsd, fmt.Sprintf("%s.%s", i.namespace, bucket)
+	i.pendingMtx.Lock()
+	i.pending++
+	i.pendingMtx.Unlock()
+
+	go func() {
+		defer func() {
+			i.pendingMtx.Lock()
+			defer i.pendingMtx.Unlock()
+			if i.pending--; i.pending == 0 {
+				i.flushed.Broadcast()
+			}
+		}()
+		f(s, name)
+	}()
+}
+
+// Flush blocks until all metrics recorded so far have been sent. Services should call this from their shutdown hook
+// so that the last metrics aren't lost when the process exits. Metrics may safely be recorded while a Flush is in
+// progress; Flush returns once nothing is left in flight.
+func (i *Instrumentation) Flush() {
+	i.pendingMtx.Lock()
+	defer i.pendingMtx.Unlock()
+	for i.pending > 0 {
+		i.flushed.Wait()
+	}
+}
+
 // SaveCounter indicates that we want to store an internal representation of the counts in this bucket so that we can
 // query it (via GetCounter).
 func (i *Instrumentation) SaveCounter(bucket string) error {
@@ -360,6 +401,11 @@ func Gauge(sampleRate float32, bucket string, n ...int) {
 	defaultClient.Gauge(sampleRate, bucket, n...)
 }
 
+// Flush wraps defaultClient.Flush
+func Flush() {
+	defaultClient.Flush()
+}
+
 // SaveCounter wraps defaultClient.SaveCounter
 func SaveCounter(bucket string) error {
 	return defaultClient.SaveCounter(bucket)
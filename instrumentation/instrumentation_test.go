@@ -1,6 +1,8 @@
 package instrumentation
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -60,3 +62,70 @@ func TestGaugeSaved(t *testing.T) {
 	i.Gauge(1.0, "foo.bar", -5)
 	assert.Equal(t, int64(-5), g.Value(), "Gauge should be -5")
 }
+
+func TestFlush(t *testing.T) {
+	i := New()
+	i.Counter(1.0, "foo.bar", 10)
+	i.Timing(1.0, "foo.bar", time.Second)
+	i.Gauge(1.0, "foo.bar", 10)
+
+	assert.NotPanics(t, i.Flush)
+	assert.NotPanics(t, Flush)
+}
+
+// countingStatter is a g2s.Statter which counts the metrics delivered to it, taking a little while over each one
+type countingStatter struct {
+	delivered int64
+}
+
+func (s *countingStatter) deliver() {
+	time.Sleep(time.Millisecond)
+	atomic.AddInt64(&s.delivered, 1)
+}
+
+func (s *countingStatter) Counter(sampleRate float32, bucket string, n ...int)          { s.deliver() }
+func (s *countingStatter) Timing(sampleRate float32, bucket string, d ...time.Duration) { s.deliver() }
+func (s *countingStatter) Gauge(sampleRate float32, bucket string, v ...string)         { s.deliver() }
+
+func TestFlushDeliversConcurrentSends(t *testing.T) {
+	i := New()
+	s := &countingStatter{}
+	i.mtx.Lock()
+	i.statsd = s
+	i.mtx.Unlock()
+
+	const senders, perSender = 10, 50
+	stop := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				i.Flush()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for n := 0; n < senders; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := 0; m < perSender; m++ {
+				i.Counter(1.0, "foo.bar", 1)
+				i.Timing(1.0, "foo.bar", time.Millisecond)
+				i.Gauge(1.0, "foo.bar", m)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-flushed
+
+	i.Flush()
+	assert.Equal(t, int64(senders*perSender*3), atomic.LoadInt64(&s.delivered),
+		"Every metric recorded before Flush returned should have been delivered")
+}
@@ -0,0 +1,48 @@
+package memcache
+
+import (
+	"math"
+	"time"
+)
+
+// Expirations longer than this are interpreted by memcached as unix timestamps, rather than relative to now
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
+// Expiration returns the value of an item's Expiration which expires it after d, or never if d is zero.
+//
+// memcached's encoding of expirations is easily misused: zero means never expire, but so does any expiration shorter
+// than a second once truncated to whole seconds, and anything over 30 days is taken to be a unix timestamp (so a TTL of
+// 31 days in seconds expires the item immediately, as it's a time in 1970). Here, positive durations are rounded up to
+// a whole second, those over 30 days are converted to a timestamp, and negative ones expire the item immediately.
+func Expiration(d time.Duration) int32 {
+	switch {
+	case d == 0:
+		return 0
+	case d < 0:
+		return -1 // memcached treats negative expirations as already expired
+	case d > maxRelativeExpiration:
+		return unixExpiration(time.Now().Add(d))
+	}
+	return int32((d + time.Second - 1) / time.Second)
+}
+
+// ExpirationAt returns the value of an item's Expiration which expires it at t, or never if t is the zero time. If t
+// has already passed the item is expired immediately.
+func ExpirationAt(t time.Time) int32 {
+	if t.IsZero() {
+		return 0
+	}
+	d := time.Until(t)
+	if d <= 0 {
+		return -1
+	}
+	return Expiration(d)
+}
+
+// unixExpiration returns t as a unix timestamp, clamped to the range of an Expiration
+func unixExpiration(t time.Time) int32 {
+	if ts := t.Unix(); ts < math.MaxInt32 {
+		return int32(ts)
+	}
+	return math.MaxInt32
+}
@@ -0,0 +1,31 @@
+package memcache
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiration(t *testing.T) {
+	assert.Equal(t, int32(0), Expiration(0), "Zero should never expire")
+	assert.Equal(t, int32(-1), Expiration(-time.Second))
+	assert.Equal(t, int32(1), Expiration(time.Millisecond), "Sub-second durations shouldn't become never expire")
+	assert.Equal(t, int32(90), Expiration(90*time.Second))
+	assert.Equal(t, int32(2), Expiration(1500*time.Millisecond))
+	assert.Equal(t, int32(30*24*60*60), Expiration(maxRelativeExpiration))
+
+	longer := 31 * 24 * time.Hour
+	exp := Expiration(longer)
+	assert.True(t, math.Abs(float64(int64(exp)-time.Now().Add(longer).Unix())) <= 1,
+		"Expirations over 30 days should be unix timestamps (got %d)", exp)
+
+	assert.Equal(t, int32(math.MaxInt32), Expiration(time.Duration(math.MaxInt64)))
+}
+
+func TestExpirationAt(t *testing.T) {
+	assert.Equal(t, int32(0), ExpirationAt(time.Time{}))
+	assert.Equal(t, int32(-1), ExpirationAt(time.Now().Add(-time.Minute)))
+	assert.Equal(t, int32(60), ExpirationAt(time.Now().Add(time.Minute)))
+}
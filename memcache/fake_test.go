@@ -0,0 +1,134 @@
+package memcache
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/hailocab/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient is an in-memory MemcacheClient for testing
+type fakeClient struct {
+	sync.Mutex
+	items map[string]*memcache.Item
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		items: make(map[string]*memcache.Item),
+	}
+}
+
+func (c *fakeClient) Add(item *memcache.Item) error {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.items[item.Key]; ok {
+		return memcache.ErrNotStored
+	}
+	c.items[item.Key] = item
+	return nil
+}
+
+func (c *fakeClient) CompareAndSwap(item *memcache.Item) error {
+	return c.Set(item)
+}
+
+func (c *fakeClient) Decrement(key string, delta uint64) (uint64, error) {
+	return 0, memcache.ErrCacheMiss
+}
+
+func (c *fakeClient) Delete(key string) error {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.items[key]; !ok {
+		return memcache.ErrCacheMiss
+	}
+	delete(c.items, key)
+	return nil
+}
+
+func (c *fakeClient) Get(key string) (*memcache.Item, error) {
+	c.Lock()
+	defer c.Unlock()
+	if it, ok := c.items[key]; ok {
+		return it, nil
+	}
+	return nil, memcache.ErrCacheMiss
+}
+
+func (c *fakeClient) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	c.Lock()
+	defer c.Unlock()
+	ret := make(map[string]*memcache.Item)
+	for _, key := range keys {
+		if it, ok := c.items[key]; ok {
+			ret[key] = it
+		}
+	}
+	return ret, nil
+}
+
+func (c *fakeClient) Increment(key string, delta uint64) (uint64, error) {
+	return 0, memcache.ErrCacheMiss
+}
+
+func (c *fakeClient) Set(item *memcache.Item) error {
+	c.Lock()
+	defer c.Unlock()
+	c.items[item.Key] = item
+	return nil
+}
+
+func TestDeleteResult(t *testing.T) {
+	prev := SetClient(newFakeClient())
+	defer SetClient(prev)
+
+	assert.NoError(t, Set(&memcache.Item{Key: "foo", Value: []byte("bar")}))
+
+	existed, err := DeleteResult("foo")
+	assert.NoError(t, err)
+	assert.True(t, existed)
+
+	existed, err = DeleteResult("foo")
+	assert.NoError(t, err)
+	assert.False(t, existed)
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	assert.False(t, EffectiveConfig().Injected)
+
+	prev := SetClient(newFakeClient())
+	assert.True(t, EffectiveConfig().Injected)
+
+	SetClient(prev)
+	assert.False(t, EffectiveConfig().Injected, "Restored client should report its config")
+}
+
+func TestFlagsRoundTrip(t *testing.T) {
+	prev := SetClient(newFakeClient())
+	defer SetClient(prev)
+
+	assert.NoError(t, SetWithFlags("encoded", []byte(`{"a":1}`), 2, 0))
+	value, flags, err := GetWithFlags("encoded")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"a":1}`), value)
+	assert.Equal(t, uint32(2), flags)
+
+	_, _, err = GetWithFlags("missing")
+	assert.Equal(t, memcache.ErrCacheMiss, err)
+}
+
+func TestSetMultiSkipsNilItems(t *testing.T) {
+	fake := newFakeClient()
+	prev := SetClient(fake)
+	defer SetClient(prev)
+
+	assert.NotPanics(t, func() {
+		assert.NoError(t, SetMulti([]*memcache.Item{nil, {Key: "foo", Value: []byte("bar")}, nil}))
+	})
+	assert.Len(t, fake.items, 1)
+	value, _, err := GetWithFlags("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), value)
+}
@@ -1,21 +1,125 @@
 package memcache
 
 import (
+	"bytes"
 	"fmt"
-	"github.com/hailocab/service-layer/healthcheck"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/hailocab/gomemcache/memcache"
+	"github.com/hailocab/service-layer/config"
+	"github.com/hailocab/service-layer/healthcheck"
 )
 
 const (
-	HealthCheckId = "com.hailocab.service.memcache"
+	HealthCheckId        = "com.hailocab.service.memcache"
+	WriteHealthCheckId   = "com.hailocab.service.memcache.write"
+	writeProbeKeyPrefix  = "healthcheck:write:"
+	writeProbeExpirySecs = 10
+	defaultProbeKey      = "healthcheck"
 )
 
-// HealthCheck asserts we can talk to memcache
+var (
+	probeClients    = make(map[string]*memcache.Client)
+	probeClientsMtx sync.Mutex
+)
+
+// probeClientsFor returns a client for each of servers, talking only to that server so we can test each one
+// individually. Clients are reused between checks; as they may be in use concurrently, a client's timeouts are never
+// changed once it is built, so a new one is built if the configured timeouts change. Clients for servers which are no
+// longer configured are discarded.
+func probeClientsFor(servers []string) map[string]*memcache.Client {
+	timeout := config.AtPath("hailo", "service", "memcache", "timeouts", "operationTimeout").
+		AsDuration(defaultOperationTimeout)
+	dialTimeout := config.AtPath("hailo", "service", "memcache", "timeouts", "dialTimeout").
+		AsDuration(defaultDialTimeout)
+
+	probeClientsMtx.Lock()
+	defer probeClientsMtx.Unlock()
+
+	clients := make(map[string]*memcache.Client, len(servers))
+	for _, server := range servers {
+		c, ok := probeClients[server]
+		if !ok || c.Timeout != timeout || c.DialTimeout != dialTimeout {
+			c = memcache.New(server)
+			c.Timeout = timeout
+			c.DialTimeout = dialTimeout
+		}
+		clients[server] = c
+	}
+	probeClients = clients
+	return clients
+}
+
+// HealthCheck asserts we can talk to memcache. Each configured server is probed individually and its status and
+// round-trip latency are returned in the details, so a partial outage shows which node is down.
+//
+// The key probed is read from hailo/service/memcache/healthcheck/key. If hailo/service/memcache/healthcheck/maxLatency
+// is set (eg. "20ms"), a server responding more slowly than that is also considered to have failed.
 func HealthCheck() healthcheck.Checker {
 	return func() (map[string]string, error) {
-		_, err := defaultClient.Get("healthcheck")
+		key := config.AtPath("hailo", "service", "memcache", "healthcheck", "key").AsString(defaultProbeKey)
+		maxLatency := config.AtPath("hailo", "service", "memcache", "healthcheck", "maxLatency").AsDuration("0")
+
+		servers := getHosts()
+		clients := probeClientsFor(servers)
+		ret := make(map[string]string)
+		var failed []string
+		for _, server := range servers {
+			start := time.Now()
+			_, err := clients[server].Get(key)
+			latency := time.Since(start)
+			ret[server+".latency"] = latency.String()
+			switch {
+			case err != nil && err != memcache.ErrCacheMiss:
+				ret[server] = fmt.Sprintf("failed: %v", err)
+				failed = append(failed, server)
+			case maxLatency > 0 && latency > maxLatency:
+				ret[server] = fmt.Sprintf("failed: latency %v exceeds %v", latency, maxLatency)
+				failed = append(failed, server)
+			default:
+				ret[server] = "ok"
+			}
+		}
+
+		if len(failed) > 0 {
+			return ret, fmt.Errorf("Memcache operation failed on %d of %d servers: %s", len(failed), len(servers),
+				strings.Join(failed, ", "))
+		}
+
+		_, err := defaultClient().Get(key)
 		if err != nil && err != memcache.ErrCacheMiss {
-			return nil, fmt.Errorf("Memcache operation failed: %v", err)
+			return ret, fmt.Errorf("Memcache operation failed: %v", err)
+		}
+
+		return ret, nil
+	}
+}
+
+// WriteHealthCheck asserts we can both write to and read from memcache, by setting a short-lived probe key and reading
+// it back. This is opt-in (use HealthCheck for a read-only check); the probe keys are namespaced and expire after a few
+// seconds so they don't accumulate.
+func WriteHealthCheck() healthcheck.Checker {
+	return func() (map[string]string, error) {
+		key := writeProbeKeyPrefix + strconv.FormatInt(time.Now().UnixNano(), 36)
+		val := []byte(key)
+
+		if err := defaultClient().Set(&memcache.Item{
+			Key:        key,
+			Value:      val,
+			Expiration: writeProbeExpirySecs,
+		}); err != nil {
+			return nil, fmt.Errorf("Memcache write probe failed: %v", err)
+		}
+
+		it, err := defaultClient().Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("Memcache read-back of write probe failed: %v", err)
+		}
+		if !bytes.Equal(it.Value, val) {
+			return nil, fmt.Errorf("Memcache read-back of write probe returned unexpected value")
 		}
 
 		return nil, nil
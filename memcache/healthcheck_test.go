@@ -0,0 +1,38 @@
+package memcache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+func TestProbeClientsFor(t *testing.T) {
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"memcache": {
+		"timeouts": {"operationTimeout": "50ms"}
+	}}}}`))
+	defer config.Load(bytes.NewBufferString(`{}`))
+
+	clients := probeClientsFor([]string{"10.0.0.1:11211", "10.0.0.2:11211"})
+	if assert.Len(t, clients, 2) {
+		assert.Equal(t, 50*time.Millisecond, clients["10.0.0.1:11211"].Timeout)
+	}
+
+	// Clients are reused, and discarded once their server is no longer configured
+	again := probeClientsFor([]string{"10.0.0.1:11211"})
+	assert.Len(t, again, 1)
+	assert.True(t, clients["10.0.0.1:11211"] == again["10.0.0.1:11211"], "Client should be reused")
+	assert.Len(t, probeClients, 1)
+
+	// A change of timeout builds a new client, rather than modifying one which may be in use
+	config.Load(bytes.NewBufferString(`{"hailo": {"service": {"memcache": {
+		"timeouts": {"operationTimeout": "80ms"}
+	}}}}`))
+	changed := probeClientsFor([]string{"10.0.0.1:11211"})
+	assert.False(t, again["10.0.0.1:11211"] == changed["10.0.0.1:11211"], "Client should be rebuilt")
+	assert.Equal(t, 50*time.Millisecond, again["10.0.0.1:11211"].Timeout)
+	assert.Equal(t, 80*time.Millisecond, changed["10.0.0.1:11211"].Timeout)
+}
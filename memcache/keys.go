@@ -0,0 +1,72 @@
+package memcache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+
+	"github.com/hailocab/gomemcache/memcache"
+
+	"github.com/hailocab/service-layer/config"
+)
+
+const (
+	// memcached rejects keys longer than this
+	defaultMaxKeyLength = 250
+	// Separates the readable prefix of a hashed key from the hash
+	hashedKeyMarker = ":sha1:"
+)
+
+// maxKeyLength returns the length above which keys are hashed
+func maxKeyLength() int {
+	l := config.AtPath("hailo", "service", "memcache", "maxKeyLength").AsInt(defaultMaxKeyLength)
+	if l <= 0 || l > defaultMaxKeyLength {
+		return defaultMaxKeyLength
+	}
+	return l
+}
+
+// safeKey returns key unchanged if it is no longer than maxKeyLength. Longer keys are replaced by as much of the key
+// as fits (to keep it readable), followed by the SHA-1 of the whole key; the replacement is stable, so operations on
+// the same key always address the same item.
+func safeKey(key string) string {
+	return safeKeyWithin(key, maxKeyLength())
+}
+
+// safeKeyWithin is safeKey, given the maximum key length
+func safeKeyWithin(key string, max int) string {
+	if len(key) <= max {
+		return key
+	}
+
+	sum := sha1.Sum([]byte(key))
+	hash := hashedKeyMarker + hex.EncodeToString(sum[:])
+	prefix := max - len(hash)
+	if prefix < 0 {
+		prefix = 0
+	}
+	return key[:prefix] + hash
+}
+
+// withSafeKey returns item, or a copy of it with its key replaced by safeKey if that differs
+func withSafeKey(item *memcache.Item) *memcache.Item {
+	if item == nil {
+		return nil
+	}
+	key := safeKey(item.Key)
+	if key == item.Key {
+		return item
+	}
+	hashed := *item
+	hashed.Key = key
+	return &hashed
+}
+
+// withKey returns item, or a copy of it with its key restored to key if that differs (ie. if it was hashed)
+func withKey(item *memcache.Item, key string) *memcache.Item {
+	if item == nil || item.Key == key {
+		return item
+	}
+	restored := *item
+	restored.Key = key
+	return &restored
+}
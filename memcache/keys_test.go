@@ -0,0 +1,50 @@
+package memcache
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hailocab/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeKey(t *testing.T) {
+	assert.Equal(t, "session:abc", safeKey("session:abc"), "Short keys should be unchanged")
+
+	long := "session:" + strings.Repeat("x", 300)
+	hashed := safeKey(long)
+	assert.Len(t, hashed, defaultMaxKeyLength)
+	assert.True(t, strings.HasPrefix(hashed, "session:xxx"), "Hashed key should keep a readable prefix")
+	assert.Equal(t, hashed, safeKey(long), "Hashing should be stable")
+	assert.NotEqual(t, hashed, safeKey(long+"y"))
+}
+
+func TestLongKeyRoundTrip(t *testing.T) {
+	fake := newFakeClient()
+	prev := SetClient(fake)
+	defer SetClient(prev)
+
+	long := "scope:" + strings.Repeat("y", 300)
+	item := &memcache.Item{Key: long, Value: []byte("v")}
+	assert.NoError(t, Set(item))
+	assert.Equal(t, long, item.Key, "Caller's item should not be modified")
+	for k := range fake.items {
+		assert.True(t, len(k) <= defaultMaxKeyLength, "Stored key too long: %d", len(k))
+	}
+
+	got, err := Get(long)
+	if assert.NoError(t, err) {
+		assert.Equal(t, long, got.Key)
+		assert.Equal(t, []byte("v"), got.Value)
+	}
+
+	items, err := GetMulti([]string{long, "missing"})
+	assert.NoError(t, err)
+	if assert.Contains(t, items, long) {
+		assert.Equal(t, long, items[long].Key)
+	}
+
+	assert.NoError(t, Delete(long))
+	_, err = Get(long)
+	assert.Equal(t, memcache.ErrCacheMiss, err)
+}
@@ -1,14 +1,23 @@
 package memcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/cihub/seelog"
+	"github.com/hailocab/platform-layer/util"
 
 	"github.com/hailocab/service-layer/config"
 	"github.com/hailocab/service-layer/dns"
 	inst "github.com/hailocab/service-layer/instrumentation"
+	"github.com/hailocab/service-layer/retry"
 	"github.com/hailocab/gomemcache/memcache"
 )
 
@@ -17,6 +26,8 @@ const (
 	defaultDialTimeout = "500ms"
 	// The default timeout used for memcached operations
 	defaultOperationTimeout = "100ms"
+	// The default maximum number of idle connections kept open per memcached server
+	defaultMaxIdleConns = memcache.DefaultMaxIdleConns
 	// Sample rate of timing events for Memcached
 	timingSampleRate = 0.33
 )
@@ -32,10 +43,127 @@ type MemcacheClient interface {
 	Set(item *memcache.Item) error
 }
 
+// MultiSetter is implemented by clients which can set many items in a single round-trip. If SetMulti returns a
+// *SetMultiError only the items it names failed; any other error means that none were set.
+type MultiSetter interface {
+	SetMulti(items []*memcache.Item) error
+}
+
+// SetMultiError is returned by SetMulti when some of the items could not be set
+type SetMultiError struct {
+	Failed map[string]error // Keyed by item key
+}
+
+func (e *SetMultiError) Error() string {
+	keys := make([]string, 0, len(e.Failed))
+	for key := range e.Failed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("Failed to set %d items: %s", len(keys), strings.Join(keys, ", "))
+}
+
+// Config describes the settings applied to the memcache client
+type Config struct {
+	Servers          []string
+	DialTimeout      time.Duration
+	OperationTimeout time.Duration
+	MaxIdleConns     int
+	// Weights of the servers (keyed by server), if they are weighted; keys are then consistently hashed onto servers in
+	// proportion to their weights (with a default of 1)
+	Weights map[string]int
+	// Injected is set if a client has been injected with SetClient, in which case the other settings are unknown
+	Injected bool
+}
+
+// clientHolder wraps the active client, as atomic.Value requires a consistent concrete type
+type clientHolder struct {
+	MemcacheClient
+	cfg Config
+}
+
+var (
+	activeClient atomic.Value // clientHolder
+	// swapMtx serialises changes to activeClient (reads are lock-free)
+	swapMtx sync.Mutex
+	// built is the client most recently built from config, so that its settings are reported again if it is restored
+	// with SetClient; protected by swapMtx
+	built clientHolder
+)
+
 var (
-	defaultClient MemcacheClient = newdefaultClient()
+	errNoServers = errors.New("No memcache servers found")
+	// initRetryPolicy governs rebuilding the initial client if no servers could be found for it (eg. DNS or the config
+	// service is briefly unavailable whilst we start up)
+	initRetryPolicy = retry.Policy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    10 * time.Second,
+		Name:        "memcached.config.init",
+	}
 )
 
+func init() {
+	client, cfg := newdefaultClient()
+	built = clientHolder{client, cfg}
+	activeClient.Store(built)
+	go watchConfig()
+	if len(cfg.Servers) == 0 {
+		go retryInitialClient()
+	}
+}
+
+// retryInitialClient rebuilds the initial client, which has no servers, once servers can be found for it. Looking
+// them up is retried with backoff (see initRetryPolicy) before giving up; after that, the client is only rebuilt when
+// config changes.
+func retryInitialClient() {
+	err := retry.Do(context.Background(), initRetryPolicy, func() error {
+		if len(getHosts()) == 0 {
+			return errNoServers
+		}
+		return nil
+	})
+	if err != nil {
+		log.Criticalf("[Memcache] %v after %d attempts; requests will fail until config changes", err,
+			initRetryPolicy.MaxAttempts)
+		return
+	}
+
+	client, cfg := newdefaultClient()
+	swapMtx.Lock()
+	defer swapMtx.Unlock()
+	// If the initial client has already been replaced (by a config change, or with SetClient) it's left alone
+	if defaultClient() != built.MemcacheClient || len(built.cfg.Servers) > 0 {
+		return
+	}
+	built = clientHolder{client, cfg}
+	activeClient.Store(built)
+}
+
+// defaultClient returns the client currently in use
+func defaultClient() MemcacheClient {
+	return activeClient.Load().(clientHolder).MemcacheClient
+}
+
+// EffectiveConfig returns the settings applied to the client currently in use
+func EffectiveConfig() Config {
+	return activeClient.Load().(clientHolder).cfg
+}
+
+// SetClient replaces the client used by this package (eg. with a fake during tests), returning the previous client so
+// that it can be restored afterwards. Whilst an injected client is in use, config changes will not replace it.
+func SetClient(c MemcacheClient) MemcacheClient {
+	swapMtx.Lock()
+	defer swapMtx.Unlock()
+	prev := defaultClient()
+	if c == built.MemcacheClient {
+		activeClient.Store(built)
+	} else {
+		activeClient.Store(clientHolder{c, Config{Injected: true}})
+	}
+	return prev
+}
+
 func getHosts() []string {
 	hostConfigPath := []string{"hailo", "service", "memcache", "servers"}
 	host := "memcached"
@@ -66,95 +194,304 @@ func getHosts() []string {
 	return hosts
 }
 
-func loadFromConfig(sl *memcache.ServerList, client *memcache.Client) {
-	hosts := getHosts()
-	log.Tracef("[Memcache] Setting memcache servers from config: %v", hosts)
-	err := sl.SetServers(hosts...)
+// readConfig reads the client settings from config
+func readConfig() Config {
+	return Config{
+		Servers: getHosts(),
+		DialTimeout: config.AtPath("hailo", "service", "memcache", "timeouts", "dialTimeout").
+			AsDuration(defaultDialTimeout),
+		OperationTimeout: config.AtPath("hailo", "service", "memcache", "timeouts", "operationTimeout").
+			AsDuration(defaultOperationTimeout),
+		MaxIdleConns: config.AtPath("hailo", "service", "memcache", "maxIdleConns").AsInt(defaultMaxIdleConns),
+		Weights:      serverWeights(),
+	}
+}
+
+// serverWeights returns the configured server weights (hailo/service/memcache/weights: a map of server to weight), or
+// nil if there are none
+func serverWeights() map[string]int {
+	weights := map[string]int{}
+	if err := config.AtPath("hailo", "service", "memcache", "weights").AsStruct(&weights); err != nil {
+		log.Warnf("[Memcache] Ignoring invalid server weights: %v", err)
+		return nil
+	}
+	if len(weights) == 0 {
+		return nil
+	}
+	return weights
+}
+
+// newSelector returns the selector used to pick a server for each key: if servers are weighted, a weighted consistent
+// hash ring, and otherwise a plain memcache.ServerList
+func newSelector(cfg Config) (memcache.ServerSelector, error) {
+	if len(cfg.Weights) > 0 {
+		return newWeightedRing(cfg.Servers, cfg.Weights)
+	}
+	sl := new(memcache.ServerList)
+	return sl, sl.SetServers(cfg.Servers...)
+}
+
+// loadFromConfig builds a client from our config, returning it along with the settings applied
+func loadFromConfig() (*memcache.Client, Config) {
+	cfg := readConfig()
+	log.Tracef("[Memcache] Setting memcache servers from config: %v (weights %v)", cfg.Servers, cfg.Weights)
+	selector, err := newSelector(cfg)
 	if err != nil {
 		log.Errorf("[Memcache] Error setting memcache servers: %v", err)
 	}
 
-	// Technically we have a race here since the timeouts are not protected by a mutex, however it isn't really a
-	// problem if the timeout is stale for a short period.
-	client.Timeout = config.AtPath("hailo", "service", "memcache", "timeouts", "operationTimeout").
-		AsDuration(defaultOperationTimeout)
+	client := memcache.NewFromSelector(selector)
+	client.Timeout = cfg.OperationTimeout
 	log.Tracef("[Memcache] Set Memcache operation timeout from config: %v", client.Timeout)
-	client.DialTimeout = config.AtPath("hailo", "service", "memcache", "timeouts", "dialTimeout").
-		AsDuration(defaultDialTimeout)
+	client.DialTimeout = cfg.DialTimeout
 	log.Tracef("[Memcache] Set Memcache dial timeout from config: %v", client.DialTimeout)
+	client.MaxIdleConns = cfg.MaxIdleConns
+	log.Tracef("[Memcache] Set Memcache max idle connections from config: %v", client.MaxIdleConns)
+
+	return client, cfg
+}
+
+// validateConfig checks that cfg could be applied: it must name at least one server (all of which resolve), have
+// positive timeouts, and at least one of its servers must accept a (throwaway) connection
+func validateConfig(cfg Config) error {
+	if len(cfg.Servers) == 0 {
+		return fmt.Errorf("No memcache servers configured")
+	}
+	if cfg.DialTimeout <= 0 || cfg.OperationTimeout <= 0 {
+		return fmt.Errorf("Memcache timeouts must be positive (dial %v, operation %v)", cfg.DialTimeout,
+			cfg.OperationTimeout)
+	}
+	if _, err := newSelector(cfg); err != nil {
+		return fmt.Errorf("Invalid memcache servers %v: %v", cfg.Servers, err)
+	}
+
+	var err error
+	for _, server := range cfg.Servers {
+		var addr net.Addr
+		if addr, err = resolveServer(server); err != nil {
+			continue
+		}
+		var conn net.Conn
+		if conn, err = net.DialTimeout(addr.Network(), addr.String(), cfg.DialTimeout); err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+	return fmt.Errorf("None of the memcache servers %v are reachable: %v", cfg.Servers, err)
 }
 
-func newdefaultClient() MemcacheClient {
-	serverSelector := new(memcache.ServerList)
-	client := memcache.NewFromSelector(serverSelector)
+// ValidateConfig checks that the current memcache config could be applied, without applying it (see validateConfig).
+// Config reloads make the same checks before replacing the client, and keep using the previous client if they fail.
+func ValidateConfig() error {
+	return validateConfig(readConfig())
+}
+
+// configHash returns a hash of the memcache config (including the servers, which may come from DNS), used to
+// determine whether the client needs rebuilding
+func configHash() string {
+	hosts := getHosts()
+	sort.Strings(hosts)
+	raw := append(config.AtPath("hailo", "service", "memcache").AsJson(), []byte(strings.Join(hosts, ","))...)
+	return util.GetMD5Hash(raw)
+}
 
-	// Listen for config changes
+// watchConfig rebuilds the client whenever the memcache config changes, atomically swapping it in so that concurrent
+// operations are unaffected
+func watchConfig() {
 	ch := config.SubscribeChanges()
-	go func() {
-		for _ = range ch {
-			loadFromConfig(serverSelector, client)
+	lastHash := configHash()
+
+	for _ = range ch {
+		hash := configHash()
+		if hash == lastHash {
+			continue
 		}
-	}()
 
-	loadFromConfig(serverSelector, client)
+		// lastHash is left as it is, so the config is validated again on the next change
+		if err := ValidateConfig(); err != nil {
+			log.Criticalf("[Memcache] Refusing to apply invalid config (keeping previous client): %v", err)
+			continue
+		}
+
+		client, cfg := newdefaultClient()
+		swapMtx.Lock()
+		if defaultClient() != built.MemcacheClient {
+			swapMtx.Unlock()
+			log.Debugf("[Memcache] Config changed, but an injected client is in use; not replacing it")
+			continue
+		}
+		built = clientHolder{client, cfg}
+		activeClient.Store(built)
+		swapMtx.Unlock()
+
+		lastHash = hash
+	}
+}
 
-	// Log on init
-	hosts := config.AtPath("hailo", "service", "memcache", "servers").AsHostnameArray(11211)
-	operationTimeout := config.AtPath("hailo", "service", "memcache", "timeouts", "dialTimeout").
-		AsDuration(defaultDialTimeout)
-	dialTimeout := config.AtPath("hailo", "service", "memcache", "timeouts", "operationTimeout").
-		AsDuration(defaultOperationTimeout)
+func newdefaultClient() (MemcacheClient, Config) {
+	client, cfg := loadFromConfig()
 
-	log.Infof("[Memcache] Initialising Memcache client to hosts %v: dial timeout %v, op timeout: %v", hosts,
-		dialTimeout, operationTimeout)
+	log.Infof("[Memcache] Initialising Memcache client to hosts %v: dial timeout %v, op timeout: %v, max idle conns: %v",
+		cfg.Servers, client.DialTimeout, client.Timeout, client.MaxIdleConns)
 
-	return client
+	return client, cfg
 }
 
 func Add(item *memcache.Item) error {
 	start := time.Now()
 	defer inst.Timing(timingSampleRate, "memcached.add", time.Since(start))
-	return defaultClient.Add(item)
+	return defaultClient().Add(withSafeKey(item))
 }
 
 func CompareAndSwap(item *memcache.Item) error {
 	start := time.Now()
 	defer inst.Timing(timingSampleRate, "memcached.compare-and-swap", time.Since(start))
-	return defaultClient.CompareAndSwap(item)
+	return defaultClient().CompareAndSwap(withSafeKey(item))
 }
 
 func Decrement(key string, delta uint64) (newValue uint64, err error) {
 	start := time.Now()
 	defer inst.Timing(timingSampleRate, "memcached.decrement", time.Since(start))
-	return defaultClient.Decrement(key, delta)
+	return defaultClient().Decrement(safeKey(key), delta)
 }
 
 func Delete(key string) error {
 	start := time.Now()
 	defer inst.Timing(timingSampleRate, "memcached.delete", time.Since(start))
-	return defaultClient.Delete(key)
+	return defaultClient().Delete(safeKey(key))
 }
 
+// DeleteResult deletes the item with the provided key, also reporting whether the key existed. A missing key is not
+// treated as an error (existed is false and err is nil).
+func DeleteResult(key string) (existed bool, err error) {
+	switch err := Delete(key); err {
+	case nil:
+		return true, nil
+	case memcache.ErrCacheMiss:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Get returns the item stored under key, including its Flags (which other clients may use to mark the value's
+// encoding)
 func Get(key string) (item *memcache.Item, err error) {
 	start := time.Now()
 	defer inst.Timing(timingSampleRate, "memcached.get", time.Since(start))
-	return defaultClient.Get(key)
+	item, err = defaultClient().Get(safeKey(key))
+	return withKey(item, key), err
 }
 
 func GetMulti(keys []string) (map[string]*memcache.Item, error) {
 	start := time.Now()
 	defer inst.Timing(timingSampleRate, "memcached.get-multi", time.Since(start))
-	return defaultClient.GetMulti(keys)
+
+	// Keys longer than memcached allows are hashed (see safeKey); results are returned under the original keys
+	safeKeys := make([]string, len(keys))
+	originals := make(map[string]string, len(keys))
+	max := maxKeyLength()
+	for i, key := range keys {
+		safeKeys[i] = safeKeyWithin(key, max)
+		originals[safeKeys[i]] = key
+	}
+
+	items, err := defaultClient().GetMulti(safeKeys)
+	if items == nil {
+		return nil, err
+	}
+	ret := make(map[string]*memcache.Item, len(items))
+	for k, item := range items {
+		key, ok := originals[k]
+		if !ok {
+			key = k
+		}
+		ret[key] = withKey(item, key)
+	}
+	return ret, err
 }
 
 func Increment(key string, delta uint64) (newValue uint64, err error) {
 	start := time.Now()
 	defer inst.Timing(timingSampleRate, "memcached.increment", time.Since(start))
-	return defaultClient.Increment(key, delta)
+	return defaultClient().Increment(safeKey(key), delta)
 }
 
+// Set stores item unconditionally. Its Flags are stored with it, and returned by Get.
 func Set(item *memcache.Item) error {
 	start := time.Now()
 	defer inst.Timing(timingSampleRate, "memcached.set", time.Since(start))
-	return defaultClient.Set(item)
+	return defaultClient().Set(withSafeKey(item))
+}
+
+// SetWithFlags stores value under key along with flags (opaque to memcached; conventionally used to mark the value's
+// encoding, for interoperability with other clients). expiration is encoded as for an item's Expiration: use
+// Expiration or ExpirationAt to compute it.
+func SetWithFlags(key string, value []byte, flags uint32, expiration int32) error {
+	return Set(&memcache.Item{
+		Key:        key,
+		Value:      value,
+		Flags:      flags,
+		Expiration: expiration,
+	})
+}
+
+// GetWithFlags returns the value stored under key along with its flags (see SetWithFlags)
+func GetWithFlags(key string) (value []byte, flags uint32, err error) {
+	item, err := Get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return item.Value, item.Flags, nil
+}
+
+// SetMulti sets many items: in a single round-trip if the client supports it (see MultiSetter), and with a Set per
+// item otherwise. If only some of the items could be set, the error is a *SetMultiError naming those which failed. Nil
+// items are skipped.
+func SetMulti(items []*memcache.Item) error {
+	start := time.Now()
+	defer func() {
+		inst.Timing(timingSampleRate, "memcached.set-multi", time.Since(start))
+	}()
+
+	client := defaultClient()
+	safeItems := make([]*memcache.Item, 0, len(items))
+	originals := make(map[string]string, len(items))
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		safe := withSafeKey(item)
+		safeItems = append(safeItems, safe)
+		originals[safe.Key] = item.Key
+	}
+
+	failed := map[string]error{}
+	if ms, ok := client.(MultiSetter); ok {
+		switch err := ms.SetMulti(safeItems).(type) {
+		case nil:
+		case *SetMultiError:
+			for key, keyErr := range err.Failed {
+				if original, ok := originals[key]; ok {
+					key = original
+				}
+				failed[key] = keyErr
+			}
+		default:
+			return err
+		}
+	} else {
+		for _, item := range safeItems {
+			if err := client.Set(item); err != nil {
+				failed[originals[item.Key]] = err
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return &SetMultiError{
+			Failed: failed,
+		}
+	}
+	return nil
 }
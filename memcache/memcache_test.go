@@ -2,12 +2,19 @@ package memcache
 
 import (
 	"bytes"
+	"errors"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	platformtesting "github.com/hailocab/platform-layer/testing"
 	"github.com/hailocab/service-layer/config"
 	"github.com/hailocab/service-layer/dns"
+	"github.com/hailocab/service-layer/retry"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMemcacheHostsSuite(t *testing.T) {
@@ -23,12 +30,12 @@ type MemcacheHostsSuite struct {
 func (s *MemcacheHostsSuite) SetupTest() {
 	s.Suite.SetupTest()
 	s.mockResolver = &dns.MockResolver{}
-	s.realResolver = dns.DefaultResolver
-	dns.DefaultResolver = s.mockResolver
+	s.realResolver = dns.SetDefaultResolver(s.mockResolver)
 }
 
 func (s *MemcacheHostsSuite) TearDownTest() {
 	s.Suite.TearDownTest()
+	dns.SetDefaultResolver(s.realResolver)
 }
 
 func (s *MemcacheHostsSuite) TestGetHostsNoConfig() {
@@ -104,3 +111,51 @@ func (s *MemcacheHostsSuite) TestGetHostsTierAndServersInConfig() {
 	s.Len(hosts, 1)
 	s.Equal(hosts[0], "10.0.0.1:11211")
 }
+
+func TestValidateConfigUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memcache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "memcached.sock")
+	l, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	cfg := Config{
+		Servers:          []string{socket},
+		DialTimeout:      time.Second,
+		OperationTimeout: time.Second,
+	}
+	assert.NoError(t, validateConfig(cfg), "A listening unix socket should pass validation")
+
+	cfg.Servers = []string{filepath.Join(dir, "missing.sock")}
+	assert.Error(t, validateConfig(cfg), "A unix socket nobody is listening on should fail validation")
+}
+
+func (s *MemcacheHostsSuite) TestRetryInitialClient() {
+	defer func(p retry.Policy) { initRetryPolicy = p }(initRetryPolicy)
+	initRetryPolicy = retry.Policy{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond}
+
+	// Start with a client which has no servers, as DNS is unavailable
+	swapMtx.Lock()
+	orig := built
+	built = clientHolder{newFakeClient(), Config{}}
+	activeClient.Store(built)
+	swapMtx.Unlock()
+	defer func() {
+		swapMtx.Lock()
+		built = orig
+		activeClient.Store(built)
+		swapMtx.Unlock()
+	}()
+	s.mockResolver.Register("memcached", []net.IP{}, errors.New("DNS unavailable"))
+
+	// Servers are found once config loads
+	go func() {
+		time.Sleep(15 * time.Millisecond)
+		config.Load(bytes.NewBufferString(`{"hailo": {"service": {"memcache": {"servers": ["10.0.0.1:11211"]}}}}`))
+	}()
+	retryInitialClient()
+	s.Equal([]string{"10.0.0.1:11211"}, EffectiveConfig().Servers)
+}
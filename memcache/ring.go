@@ -0,0 +1,97 @@
+package memcache
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/hailocab/gomemcache/memcache"
+)
+
+// Each unit of a server's weight places this many points for it on the ring (each md5 digest yields four points)
+const ringPointsPerWeight = 160
+
+// weightedRing is a memcache.ServerSelector which consistently hashes keys onto servers. Each server is placed on the
+// ring at a number of points proportional to its weight, so it receives a proportional share of the keys.
+type weightedRing struct {
+	points []ringPoint // Sorted by hash
+	addrs  []net.Addr
+}
+
+type ringPoint struct {
+	hash uint32
+	addr net.Addr
+}
+
+// newWeightedRing returns a ring of servers, weighted by weights (keyed by server). Servers without a (positive)
+// weight have a weight of 1.
+func newWeightedRing(servers []string, weights map[string]int) (*weightedRing, error) {
+	r := &weightedRing{}
+	for _, server := range servers {
+		addr, err := resolveServer(server)
+		if err != nil {
+			return &weightedRing{}, err
+		}
+		r.addrs = append(r.addrs, addr)
+
+		weight := weights[server]
+		if weight < 1 {
+			weight = 1
+		}
+		for i := 0; i < weight*ringPointsPerWeight/4; i++ {
+			digest := md5.Sum([]byte(fmt.Sprintf("%s-%d", server, i)))
+			for j := 0; j < 4; j++ {
+				r.points = append(r.points, ringPoint{
+					hash: binary.LittleEndian.Uint32(digest[j*4:]),
+					addr: addr,
+				})
+			}
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r, nil
+}
+
+// resolveServer resolves a server address as memcache.ServerList does: as a unix socket if it contains a slash, and a
+// TCP address otherwise
+func resolveServer(server string) (net.Addr, error) {
+	if strings.Contains(server, "/") {
+		return net.ResolveUnixAddr("unix", server)
+	}
+	return net.ResolveTCPAddr("tcp", server)
+}
+
+func ringHash(key string) uint32 {
+	digest := md5.Sum([]byte(key))
+	return binary.LittleEndian.Uint32(digest[:4])
+}
+
+// PickServer returns the server owning the first point on the ring at or after the key's hash
+func (r *weightedRing) PickServer(key string) (net.Addr, error) {
+	if len(r.points) == 0 {
+		return nil, memcache.ErrNoServers
+	}
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].addr, nil
+}
+
+// Each calls f for each server on the ring, stopping at the first error
+func (r *weightedRing) Each(f func(net.Addr) error) error {
+	for _, addr := range r.addrs {
+		if err := f(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package memcache
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// distribution returns the fraction of n keys picked for each server
+func distribution(t *testing.T, r *weightedRing, n int) map[string]float64 {
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		addr, err := r.PickServer(fmt.Sprintf("key-%d", i))
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		counts[addr.String()]++
+	}
+	fractions := map[string]float64{}
+	for server, count := range counts {
+		fractions[server] = float64(count) / float64(n)
+	}
+	return fractions
+}
+
+func TestWeightedRingDistribution(t *testing.T) {
+	servers := []string{"10.0.0.1:11211", "10.0.0.2:11211", "10.0.0.3:11211"}
+
+	// Equal (default) weights distribute keys uniformly
+	r, err := newWeightedRing(servers, nil)
+	assert.NoError(t, err)
+	for server, fraction := range distribution(t, r, 30000) {
+		assert.True(t, math.Abs(fraction-1.0/3) < 0.05, "%s got %.3f of keys with equal weights", server, fraction)
+	}
+
+	// Otherwise keys are distributed in proportion to the weights
+	r, err = newWeightedRing(servers, map[string]int{"10.0.0.1:11211": 2, "10.0.0.3:11211": 1})
+	assert.NoError(t, err)
+	expected := map[string]float64{"10.0.0.1:11211": 0.5, "10.0.0.2:11211": 0.25, "10.0.0.3:11211": 0.25}
+	for server, fraction := range distribution(t, r, 40000) {
+		assert.True(t, math.Abs(fraction-expected[server]) < 0.05, "%s got %.3f of keys, expected %.2f", server,
+			fraction, expected[server])
+	}
+}
+
+func TestWeightedRingIsConsistent(t *testing.T) {
+	r, _ := newWeightedRing([]string{"10.0.0.1:11211", "10.0.0.2:11211"}, nil)
+	a, _ := r.PickServer("some-key")
+	b, _ := r.PickServer("some-key")
+	assert.Equal(t, a, b)
+
+	_, err := (&weightedRing{}).PickServer("some-key")
+	assert.Error(t, err)
+}
@@ -33,7 +33,7 @@ func getHosts(port int, path ...string) []string {
 	}
 
 	// should we lookup dns?
-	if config.AtPath("hailo", "service", "nsq", "disableDnsLookup").AsBool() {
+	if config.AtPath("hailo", "service", "nsq", "disableDnsLookup").AsBool(false) {
 		return []string{}
 	}
 
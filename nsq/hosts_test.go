@@ -24,13 +24,12 @@ type NsqHostsSuite struct {
 func (s *NsqHostsSuite) SetupTest() {
 	s.Suite.SetupTest()
 	s.mockResolver = &dns.MockResolver{}
-	s.realResolver = dns.DefaultResolver
-	dns.DefaultResolver = s.mockResolver
+	s.realResolver = dns.SetDefaultResolver(s.mockResolver)
 }
 
 func (s *NsqHostsSuite) TearDownTest() {
 	s.Suite.TearDownTest()
-	dns.DefaultResolver = s.realResolver
+	dns.SetDefaultResolver(s.realResolver)
 	config.Load(bytes.NewBufferString("{}"))
 }
 
@@ -137,7 +137,7 @@ func (s *DefaultSubscriber) loadFromConfig() {
 
 func (s *DefaultSubscriber) doLoad() error {
 	subHosts := config.AtPath("hailo", "service", "nsq", "subHosts").AsHostnameArray(4150)
-	disableLookupd := config.AtPath("hailo", "service", "nsq", "disableLookupd").AsBool()
+	disableLookupd := config.AtPath("hailo", "service", "nsq", "disableLookupd").AsBool(false)
 	lookupdHosts := getHosts(4161, "hailo", "service", "nsq", "nsqlookupdSeeds")
 
 	h := md5.New()
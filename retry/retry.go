@@ -0,0 +1,76 @@
+/*
+Package retry retries operations which fail with transient errors, with jittered exponential backoff between attempts.
+It is shared by the various subsystems, which each supply a Policy describing how (and which errors) to retry.
+*/
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	inst "github.com/hailocab/service-layer/instrumentation"
+)
+
+// Policy describes how an operation is retried
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first (values below 1 are treated as 1)
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubling for each subsequent one
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts (zero means uncapped)
+	MaxDelay time.Duration
+	// IsRetryable classifies errors as transient (and so worth retrying). If nil, all errors are retried.
+	IsRetryable func(error) bool
+	// Name identifies the subsystem; if set, each retry increments the counter "<Name>.retries"
+	Name string
+}
+
+// Backoff returns how long to wait before the retry following the given (zero-based) attempt. The delay grows
+// exponentially from BaseDelay (capped at MaxDelay) and is jittered, so that callers failing together don't all retry
+// in lockstep. Without a MaxDelay, the delay saturates at the longest representable duration rather than overflowing.
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < attempt && delay > 0 && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		if delay > math.MaxInt64/2 {
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (p Policy) retryable(err error) bool {
+	return p.IsRetryable == nil || p.IsRetryable(err)
+}
+
+// Do calls fn until it succeeds, it returns an error which isn't retryable, or the policy's attempts are exhausted,
+// returning the last error. If ctx is done whilst waiting to retry, the context's error is returned.
+func Do(ctx context.Context, p Policy, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !p.retryable(err) || attempt+1 >= p.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(p.Backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		if p.Name != "" {
+			inst.Counter(1.0, p.Name+".retries", 1)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	errTransient = errors.New("Transient")
+	errPermanent = errors.New("Permanent")
+)
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}, func() error {
+		calls++
+		if calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestDoGivesUp(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{MaxAttempts: 2, BaseDelay: time.Millisecond}, func() error {
+		calls++
+		return errTransient
+	})
+	assert.Equal(t, errTransient, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDoNotRetryable(t *testing.T) {
+	calls := 0
+	p := Policy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Millisecond,
+		IsRetryable: func(err error) bool { return err == errTransient },
+	}
+	err := Do(context.Background(), p, func() error {
+		calls++
+		return errPermanent
+	})
+	assert.Equal(t, errPermanent, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDoContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := Do(ctx, Policy{MaxAttempts: 5, BaseDelay: time.Second}, func() error {
+		return errTransient
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	for attempt := 0; attempt < 10; attempt++ {
+		d := p.Backoff(attempt)
+		assert.True(t, d >= time.Second/2, "Delay %v for attempt %d below minimum", d, attempt)
+		assert.True(t, d <= 30*time.Second, "Delay %v for attempt %d exceeds maximum", d, attempt)
+	}
+	assert.True(t, p.Backoff(10) >= 15*time.Second, "Delay should be capped at (jittered) max")
+}
+
+func TestBackoffUncapped(t *testing.T) {
+	p := Policy{BaseDelay: time.Second}
+	for _, attempt := range []int{10, 33, 34, 63, 64, 100, 1000} {
+		d := p.Backoff(attempt)
+		assert.True(t, d >= p.Backoff(0), "Delay %v for attempt %d shouldn't overflow", d, attempt)
+	}
+	assert.True(t, p.Backoff(1000) >= math.MaxInt64/2, "Delay should saturate")
+}
@@ -0,0 +1,69 @@
+/*
+Package singleflight collapses concurrent calls for the same key (eg. lookups of the same name) into a single call,
+whose result is shared by all of the callers. It is shared by the various subsystems which coalesce lookups.
+*/
+package singleflight
+
+import (
+	"fmt"
+	"sync"
+)
+
+// call is an in-flight (or completed) call, shared by all callers for the same key concurrently
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Group collapses concurrent calls for the same key. The zero Group is ready to use.
+type Group struct {
+	mtx   sync.Mutex
+	calls map[string]*call
+	// joined, if set, is sent the key whenever a caller joins a call already in flight (for tests)
+	joined chan<- string
+}
+
+// Do calls fn, unless a call for key is already in flight, in which case it waits for that and returns its result (and
+// shared is true). The returned value is shared so callers must not modify it.
+//
+// If fn panics, the panic is propagated to the caller which made the call, while callers waiting on it are returned an
+// error; the next call for key calls fn again.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, shared bool, err error) {
+	g.mtx.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		joined := g.joined
+		g.mtx.Unlock()
+		if joined != nil {
+			joined <- key
+		}
+		c.wg.Wait()
+		return c.val, true, c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mtx.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.val, c.err = nil, fmt.Errorf("Call for %s panicked: %v", key, r)
+			g.done(key, c)
+			panic(r)
+		}
+		g.done(key, c)
+	}()
+	c.val, c.err = fn()
+	return c.val, false, c.err
+}
+
+// done releases the callers waiting on c, so that the next call for key calls through again
+func (g *Group) done(key string, c *call) {
+	g.mtx.Lock()
+	delete(g.calls, key)
+	g.mtx.Unlock()
+	c.wg.Done()
+}
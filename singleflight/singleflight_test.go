@@ -0,0 +1,102 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoCollapsesConcurrentCalls(t *testing.T) {
+	joined := make(chan string)
+	g := &Group{joined: joined}
+	var calls, shared int32
+	started, release := make(chan struct{}), make(chan struct{})
+
+	fn := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return "dave", nil
+	}
+
+	var wg sync.WaitGroup
+	call := func() {
+		defer wg.Done()
+		v, wasShared, err := g.Do("sess123", fn)
+		assert.NoError(t, err)
+		assert.Equal(t, "dave", v)
+		if wasShared {
+			atomic.AddInt32(&shared, 1)
+		}
+	}
+	wg.Add(1)
+	go call()
+	<-started
+
+	// Release the call only once every other caller has joined it
+	for i := 0; i < 9; i++ {
+		wg.Add(1)
+		go call()
+	}
+	for i := 0; i < 9; i++ {
+		assert.Equal(t, "sess123", <-joined)
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, int32(9), atomic.LoadInt32(&shared))
+
+	// Once complete, the next call calls through again
+	_, wasShared, _ := g.Do("sess123", fn)
+	assert.False(t, wasShared)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestDoKeysAreIndependent(t *testing.T) {
+	g := &Group{}
+	v, _, err := g.Do("a", func() (interface{}, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	_, _, err = g.Do("b", func() (interface{}, error) { return nil, errors.New("Lookup failed") })
+	assert.EqualError(t, err, "Lookup failed")
+}
+
+func TestDoPanic(t *testing.T) {
+	joined := make(chan string)
+	g := &Group{joined: joined}
+	started, release := make(chan struct{}), make(chan struct{})
+
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		g.Do("sess123", func() (interface{}, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waited := make(chan error, 1)
+	go func() {
+		_, shared, err := g.Do("sess123", func() (interface{}, error) { return nil, nil })
+		assert.True(t, shared)
+		waited <- err
+	}()
+	<-joined
+	close(release)
+
+	assert.Equal(t, "boom", <-panicked, "The panic should be propagated to the caller which made the call")
+	assert.EqualError(t, <-waited, "Call for sess123 panicked: boom")
+
+	// The key isn't left stuck
+	v, shared, err := g.Do("sess123", func() (interface{}, error) { return "dave", nil })
+	assert.NoError(t, err)
+	assert.False(t, shared)
+	assert.Equal(t, "dave", v)
+}
@@ -8,7 +8,7 @@ import (
 // config.
 func NewGlobalLeader(id string) Leader {
 	for {
-		if config.AtPath("leaders", "isLeader").AsBool() {
+		if config.AtPath("leaders", "isLeader").AsBool(false) {
 			break
 		}
 		<-config.SubscribeChanges()
@@ -0,0 +1,73 @@
+package zookeeper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The maximum number of checks ExistsMany has in flight at once
+const existsManyConcurrency = 10
+
+// ExistsManyError is returned by ExistsMany when some of the paths could not be checked
+type ExistsManyError struct {
+	Failed map[string]error // Keyed by path
+}
+
+func (e *ExistsManyError) Error() string {
+	paths := make([]string, 0, len(e.Failed))
+	for path := range e.Failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return fmt.Sprintf("Failed to check existence of %d paths: %s", len(paths), strings.Join(paths, ", "))
+}
+
+// ExistsMany checks whether each of the paths exists, making the checks concurrently (but with no more than
+// existsManyConcurrency in flight), and returns a map of path to existence. A failure to check one path doesn't abort
+// the others: the error is then an *ExistsManyError naming the paths which failed, which are absent from the map.
+func ExistsMany(paths []string) (map[string]bool, error) {
+	once.Do(setup)
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	return existsMany(defaultClient, paths)
+}
+
+func existsMany(client ZookeeperClient, paths []string) (map[string]bool, error) {
+	var (
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, existsManyConcurrency)
+		resMtx sync.Mutex
+		exists = make(map[string]bool, len(paths))
+		failed = map[string]error{}
+	)
+	for _, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(path string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ex, _, err := client.Exists(path)
+			resMtx.Lock()
+			defer resMtx.Unlock()
+			if err != nil {
+				failed[path] = err
+				return
+			}
+			exists[path] = ex
+		}(path)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return exists, &ExistsManyError{
+			Failed: failed,
+		}
+	}
+	return exists, nil
+}
@@ -0,0 +1,23 @@
+package zookeeper
+
+import (
+	"errors"
+	"testing"
+
+	gozk "github.com/hailocab/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExistsMany(t *testing.T) {
+	client := &MockZookeeperClient{}
+	client.On("Exists", "/services/a").Return(true, &gozk.Stat{}, nil)
+	client.On("Exists", "/services/b").Return(false, (*gozk.Stat)(nil), nil)
+	client.On("Exists", "/services/c").Return(false, (*gozk.Stat)(nil), errors.New("Connection lost"))
+
+	exists, err := existsMany(client, []string{"/services/a", "/services/b", "/services/c"})
+	assert.Equal(t, map[string]bool{"/services/a": true, "/services/b": false}, exists)
+	if multiErr, ok := err.(*ExistsManyError); assert.True(t, ok, "Expected an *ExistsManyError, got %v", err) {
+		assert.Len(t, multiErr.Failed, 1)
+		assert.EqualError(t, multiErr, "Failed to check existence of 1 paths: /services/c")
+	}
+}
@@ -0,0 +1,69 @@
+package zookeeper
+
+import (
+	gozk "github.com/hailocab/go-zookeeper/zk"
+)
+
+// MultiOp is a single operation within a transaction (see Transact). Build these with CreateOp, SetDataOp, DeleteOp and
+// CheckVersionOp.
+type MultiOp func(ops *gozk.MultiOps)
+
+// CreateOp creates a node at path
+func CreateOp(path string, data []byte, flags int32, acl []gozk.ACL) MultiOp {
+	return func(ops *gozk.MultiOps) {
+		ops.Create = append(ops.Create, gozk.CreateRequest{
+			Path:  path,
+			Data:  data,
+			Acl:   acl,
+			Flags: flags,
+		})
+	}
+}
+
+// SetDataOp sets the data of the node at path, provided its version matches (-1 matches any version)
+func SetDataOp(path string, data []byte, version int32) MultiOp {
+	return func(ops *gozk.MultiOps) {
+		ops.SetData = append(ops.SetData, gozk.SetDataRequest{
+			Path:    path,
+			Data:    data,
+			Version: version,
+		})
+	}
+}
+
+// DeleteOp deletes the node at path, provided its version matches (-1 matches any version)
+func DeleteOp(path string, version int32) MultiOp {
+	return func(ops *gozk.MultiOps) {
+		ops.Delete = append(ops.Delete, gozk.DeleteRequest{
+			Path:    path,
+			Version: version,
+		})
+	}
+}
+
+// CheckVersionOp fails the transaction unless the node at path is at the given version
+func CheckVersionOp(path string, version int32) MultiOp {
+	return func(ops *gozk.MultiOps) {
+		ops.Check = append(ops.Check, gozk.CheckVersionRequest{
+			Path:    path,
+			Version: version,
+		})
+	}
+}
+
+func buildMultiOps(ops []MultiOp) gozk.MultiOps {
+	result := gozk.MultiOps{}
+	for _, op := range ops {
+		op(&result)
+	}
+	return result
+}
+
+// Transact applies the operations as a single transaction (via Multi): either all of them are applied, or (if any
+// fails) none are.
+//
+// Note that the operations are grouped by kind when sent to ZooKeeper, so they are not necessarily applied in the order
+// given. Operations of the same kind (eg. several creates) do retain their relative order.
+func Transact(ops ...MultiOp) error {
+	return Multi(buildMultiOps(ops))
+}
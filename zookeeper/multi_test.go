@@ -0,0 +1,29 @@
+package zookeeper
+
+import (
+	"testing"
+
+	gozk "github.com/hailocab/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMultiOps(t *testing.T) {
+	ops := buildMultiOps([]MultiOp{
+		CreateOp("/services/foo", []byte("foo"), 0, gozk.WorldACL(gozk.PermAll)),
+		CreateOp("/services/foo/meta", []byte("meta"), 0, gozk.WorldACL(gozk.PermAll)),
+		SetDataOp("/services/index", []byte("foo"), 3),
+		DeleteOp("/services/bar", -1),
+	})
+
+	if assert.Len(t, ops.Create, 2) {
+		assert.Equal(t, "/services/foo", ops.Create[0].Path)
+		assert.Equal(t, "/services/foo/meta", ops.Create[1].Path)
+	}
+	if assert.Len(t, ops.SetData, 1) {
+		assert.Equal(t, int32(3), ops.SetData[0].Version)
+	}
+	if assert.Len(t, ops.Delete, 1) {
+		assert.Equal(t, "/services/bar", ops.Delete[0].Path)
+	}
+	assert.Len(t, ops.Check, 0)
+}
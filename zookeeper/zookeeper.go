@@ -20,6 +20,9 @@ import (
 	gozk "github.com/hailocab/go-zookeeper/zk"
 )
 
+// ErrNoNode is returned by operations on a node which does not exist (so callers needn't import the underlying client)
+var ErrNoNode = gozk.ErrNoNode
+
 type ZookeeperClient interface {
 	Children(path string) ([]string, *gozk.Stat, error)
 	ChildrenW(path string) ([]string, *gozk.Stat, <-chan gozk.Event, error)
@@ -218,6 +221,8 @@ func TearDown() {
 	}
 }
 
+// Children returns the names of the children of the node at path, along with its stat. If there is no such node, the
+// error is ErrNoNode.
 func Children(path string) ([]string, *gozk.Stat, error) {
 	once.Do(setup)
 	mtx.RLock()
@@ -281,6 +286,8 @@ func ExistsW(path string) (bool, *gozk.Stat, <-chan gozk.Event, error) {
 	return ex, stat, ch, err
 }
 
+// Get returns the data held by the node at path, along with its stat. If there is no such node, the error is
+// ErrNoNode.
 func Get(path string) ([]byte, *gozk.Stat, error) {
 	once.Do(setup)
 	mtx.RLock()
@@ -317,6 +324,8 @@ func Multi(ops gozk.MultiOps) error {
 	return err
 }
 
+// Set sets the data held by the node at path, provided its version matches (-1 matches any version). If there is no
+// such node, the error is ErrNoNode.
 func Set(path string, data []byte, version int32) (*gozk.Stat, error) {
 	once.Do(setup)
 	mtx.RLock()
@@ -22,12 +22,11 @@ type ZkHostsSuite struct {
 
 func (s *ZkHostsSuite) SetupTest() {
 	s.mockResolver = &dns.MockResolver{}
-	s.realResolver = dns.DefaultResolver
-	dns.DefaultResolver = s.mockResolver
+	s.realResolver = dns.SetDefaultResolver(s.mockResolver)
 }
 
 func (s *ZkHostsSuite) TearDownTest() {
-	dns.DefaultResolver = s.realResolver
+	dns.SetDefaultResolver(s.realResolver)
 	config.Load(bytes.NewBufferString("{}"))
 }
 